@@ -78,14 +78,14 @@ func (m buildModel) View() string {
 }
 
 // resolveWithProgress runs nix.Resolve with the bubbletea spinner, returns the env.
-func resolveWithProgress(shellNixPath string) (*nix.ResolvedEnv, error) {
+func resolveWithProgress(src *nix.Source) (*nix.ResolvedEnv, error) {
 	progressCh := make(chan string, 50)
 	resultCh := make(chan struct {
 		env *nix.ResolvedEnv
 		err error
 	}, 1)
 	go func() {
-		env, err := nix.Resolve(shellNixPath, progressCh)
+		env, err := nix.Resolve(src, progressCh)
 		close(progressCh)
 		resultCh <- struct {
 			env *nix.ResolvedEnv
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "inspect the shared environment cache",
+	Long: `lagoon cache ls
+
+Resolved environments are cached by content, not by project path: every checkout
+whose lagoon.toml generates the same nix expression shares one entry, so moving,
+re-cloning or adding a worktree starts warm. Each project's cache dir links to
+the environment it last used.`,
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "list cached environments and the projects using them",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheLs,
+}
+
+func init() {
+	cacheCmd.AddCommand(cacheLsCmd)
+}
+
+const (
+	envLink     = "env"     // in a project's cache dir: symlink to the environment it uses
+	projectFile = "project" // in a project's cache dir: the project's absolute path
+)
+
+// envBase holds one directory per environment, named by its sum.
+func envBase() string {
+	return filepath.Join(lagoonCacheBase(), "envs")
+}
+
+// linkEnv points the project's cache dir at envDir and records the project path.
+// it's rewritten on every resolve, so the link's mtime is when the project last used it.
+func linkEnv(cacheDir, project, envDir string) error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+	// relative, so the whole cache dir can move
+	target, err := filepath.Rel(cacheDir, envDir)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(cacheDir, envLink+".tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(cacheDir, envLink)); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cacheDir, projectFile), []byte(project+"\n"), 0644)
+}
+
+// envUse is one project's link into the environment cache.
+type envUse struct {
+	Project string    // absolute project path
+	Dir     string    // the project's cache dir
+	Sum     string    // environment it links to
+	Used    time.Time // last resolve from this project
+}
+
+// envUses reads every project's env link, most recently used first.
+func envUses() []envUse {
+	links, _ := filepath.Glob(filepath.Join(lagoonCacheBase(), "*", envLink))
+	var uses []envUse
+	for _, link := range links {
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+		info, err := os.Lstat(link)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Dir(link)
+		project, _ := os.ReadFile(filepath.Join(dir, projectFile))
+		uses = append(uses, envUse{
+			Project: strings.TrimSpace(string(project)),
+			Dir:     dir,
+			Sum:     filepath.Base(target),
+			Used:    info.ModTime(),
+		})
+	}
+	sort.Slice(uses, func(i, j int) bool { return uses[i].Used.After(uses[j].Used) })
+	return uses
+}
+
+// projectEnv returns the sum the project's cache dir links to, or "".
+func projectEnv(cacheDir string) string {
+	target, err := os.Readlink(filepath.Join(cacheDir, envLink))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+func runCacheLs(cmd *cobra.Command, args []string) error {
+	entries, err := os.ReadDir(envBase())
+	if err != nil || len(entries) == 0 {
+		fmt.Println("  no cached environments yet — run 'lagoon shell' in a project")
+		return nil
+	}
+	bySum := map[string][]envUse{}
+	for _, u := range envUses() {
+		bySum[u.Sum] = append(bySum[u.Sum], u)
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		mark, state := ok("●"), ""
+		if _, err := os.Stat(filepath.Join(envBase(), e.Name(), "env.json")); err != nil {
+			mark, state = warn("○"), "  (not built)"
+		}
+		fmt.Printf("  %s %s%s\n", mark, e.Name(), state)
+		uses := bySum[e.Name()]
+		if len(uses) == 0 {
+			fmt.Println("      no projects")
+		}
+		for _, u := range uses {
+			gone := ""
+			if _, err := os.Stat(u.Project); err != nil {
+				gone = "  " + warn("(gone)")
+			}
+			fmt.Printf("      %s  %s%s\n", u.Used.Format("2006-01-02 15:04"), u.Project, gone)
+		}
+	}
+	fmt.Println("\n  " + ok("●") + " built   " + warn("○") + " generated, never resolved")
+	return nil
+}
@@ -3,10 +3,15 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 
 	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/netproxy"
+	"github.com/imraghavojha/lagoon/internal/nix"
 	"github.com/spf13/cobra"
 )
 
@@ -27,20 +32,61 @@ func runCheck(cmd *cobra.Command, args []string) error {
 
 	// structural validation (was lint)
 	var errs []string
-	if len(cfg.Packages) == 0 {
+	if len(cfg.Packages) == 0 && len(cfg.Langs()) == 0 && len(cfg.LocalPackages) == 0 && cfg.Flake == "" {
 		errs = append(errs, "packages list is empty")
 	}
-	if cfg.NixpkgsCommit == "" {
+	if cfg.NixpkgsCommit == "" && !cfg.UsesFlakes() {
 		errs = append(errs, "nixpkgs_commit is missing")
 	}
-	if cfg.NixpkgsSHA256 == "" {
+	if cfg.NixpkgsSHA256 == "" && !cfg.UsesFlakes() {
 		errs = append(errs, "nixpkgs_sha256 is missing")
 	}
-	if cfg.Profile != "minimal" && cfg.Profile != "network" {
-		errs = append(errs, `profile must be "minimal" or "network"`)
+	switch cfg.Profile {
+	case "minimal", "network":
+	case "allowlist":
+		if len(cfg.Allow) == 0 {
+			errs = append(errs, `profile "allowlist" needs at least one entry in allow`)
+		}
+		if _, err := netproxy.ParseAllowlist(cfg.Allow); err != nil {
+			errs = append(errs, err.Error())
+		}
+	default:
+		errs = append(errs, `profile must be "minimal", "network" or "allowlist"`)
+	}
+	if err := cfg.Limits.Check(); err != nil {
+		errs = append(errs, "limits: "+err.Error())
+	}
+	if _, err := config.ParsePorts(cfg.Ports); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if _, err := cfg.ServiceOrder(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, target := range slices.Sorted(maps.Keys(cfg.Volumes)) {
+		if err := config.CheckVolume(target, cfg.Volumes[target]); err != nil {
+			errs = append(errs, err.Error())
+		}
 	}
+	absPath, _ := filepath.Abs(".")
+	for _, m := range cfg.Mounts {
+		if _, err := mountSource(m, absPath); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, p := range slices.Concat(cfg.LocalPackages, cfg.Overlays) {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(absPath, p)
+		}
+		if _, err := os.Stat(p); err != nil {
+			errs = append(errs, "local nix file not found: "+p)
+		}
+	}
+	if _, err := sandboxEnvs(cfg, absPath, nil); err != nil {
+		errs = append(errs, err.Error())
+	}
+	errs = append(errs, plaintextSecrets(cfg, absPath)...)
 	seen := map[string]bool{}
-	for _, pkg := range cfg.Packages {
+	for _, pkg := range cfg.PackageNames() {
 		if seen[pkg] {
 			errs = append(errs, "duplicate package: "+pkg)
 		}
@@ -53,12 +99,35 @@ func runCheck(cmd *cobra.Command, args []string) error {
 		return errors.New("lagoon.toml is invalid")
 	}
 
+	// a flake's devShell is checked by nix itself when it's resolved
+	if cfg.Flake != "" {
+		fmt.Println(ok("✓") + " lagoon.toml is valid — packages come from flake " + cfg.Flake)
+		return nil
+	}
+
 	// network package search (was lint)
 	fmt.Println("  checking " + fmt.Sprint(len(cfg.Packages)) + " packages against nixpkgs…")
 	fmt.Println()
 	var bad []string
 	offline := false
-	for _, pkg := range cfg.Packages {
+	for _, p := range cfg.Packages {
+		pkg := p.Name
+		if p.Pinned() {
+			// search.nixos.org only knows the current channel — ask the pinned revision itself
+			pkg += " @ " + p.NixpkgsCommit[:12]
+			found, err := nix.HasPinnedAttr(p)
+			switch {
+			case err != nil:
+				offline = true
+				fmt.Println(warn("?") + "  " + pkg + "  (couldn't fetch that nixpkgs revision)")
+			case found:
+				fmt.Println(ok("✓") + "  " + pkg)
+			default:
+				bad = append(bad, pkg)
+				fmt.Println(fail("✗") + "  " + pkg)
+			}
+			continue
+		}
 		results, err := queryNixpkgs(pkg)
 		if err != nil {
 			offline = true
@@ -86,3 +155,39 @@ func runCheck(cmd *cobra.Command, args []string) error {
 	}
 	return nil
 }
+
+// plaintextSecrets reports [secrets] written as values and credentials sitting in
+// [env] or a service's env — lagoon.toml is committed, so they'd end up in git.
+func plaintextSecrets(cfg *config.Config, projectPath string) []string {
+	var errs []string
+	for _, name := range slices.Sorted(maps.Keys(cfg.Secrets)) {
+		s := cfg.Secrets[name]
+		if s.Plain != "" {
+			errs = append(errs, fmt.Sprintf("secret %q is written in plaintext — use file, command, env or prompt", name))
+			continue
+		}
+		if s.File != "" {
+			p, err := secretPath(s.File, projectPath)
+			if err == nil {
+				_, err = os.Stat(p)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("secret %q: file not found: %s", name, s.File))
+			}
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(cfg.Env)) {
+		if config.LooksSecret(k, cfg.Env[k]) {
+			errs = append(errs, fmt.Sprintf("[env] %s looks like a plaintext secret — move it to [secrets]", k))
+		}
+	}
+	for _, svc := range slices.Sorted(maps.Keys(cfg.Up)) {
+		env := cfg.Up[svc].Env
+		for _, k := range slices.Sorted(maps.Keys(env)) {
+			if config.LooksSecret(k, env[k]) {
+				errs = append(errs, fmt.Sprintf("[up.%s] env %s looks like a plaintext secret — move it to [secrets]", svc, k))
+			}
+		}
+	}
+	return errs
+}
@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"os/exec"
-	"path/filepath"
 	"strings"
 
 	"github.com/imraghavojha/lagoon/internal/nix"
@@ -11,7 +10,7 @@ import (
 
 // closurePaths returns the full transitive nix closure for all packages in the environment.
 func closurePaths(resolved *nix.ResolvedEnv) ([]string, error) {
-	roots := envStorePaths(resolved)
+	roots := nix.StorePaths(resolved)
 	if len(roots) == 0 {
 		return nil, fmt.Errorf("no nix store paths in environment PATH")
 	}
@@ -21,17 +20,3 @@ func closurePaths(resolved *nix.ResolvedEnv) ([]string, error) {
 	}
 	return strings.Fields(string(out)), nil
 }
-
-// envStorePaths extracts the top-level nix store paths from the environment PATH.
-func envStorePaths(env *nix.ResolvedEnv) []string {
-	seen := map[string]bool{}
-	var paths []string
-	for _, entry := range strings.Split(env.PATH, ":") {
-		sp := filepath.Dir(entry)
-		if strings.HasPrefix(sp, "/nix/store/") && !seen[sp] {
-			seen[sp] = true
-			paths = append(paths, sp)
-		}
-	}
-	return paths
-}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/imraghavojha/lagoon/internal/nix"
+	"github.com/imraghavojha/lagoon/internal/sandbox"
+)
+
+// upStateFile records a detached 'lagoon up -d' in the project cache dir.
+const upStateFile = "up.json"
+
+// detachWait is how long 'up -d' waits for the supervisor to record its first state.
+const detachWait = 30 * time.Second
+
+// upState is what 'lagoon ps', 'logs' and 'down' know about detached services.
+type upState struct {
+	PID      int        `json:"pid"`                 // the supervising lagoon process
+	PIDStart uint64     `json:"pid_start,omitempty"` // its start time, to tell a reused pid apart
+	Project  string     `json:"project"`
+	Started  string     `json:"started"`
+	Services []svcState `json:"services"` // in start order
+}
+
+type svcState struct {
+	Name  string `json:"name"`
+	PID   int    `json:"pid"`                 // 0 when not running
+	Start uint64 `json:"pid_start,omitempty"` // start time of PID
+	State string `json:"state"`               // waiting, running, ready, restarting, exited, failed, skipped, stopped
+	Log   string `json:"log"`
+}
+
+// readUpState loads up.json from cacheDir.
+func readUpState(cacheDir string) (*upState, error) {
+	b, err := os.ReadFile(filepath.Join(cacheDir, upStateFile))
+	if err != nil {
+		return nil, err
+	}
+	var st upState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// running reports whether the supervisor that wrote this state is still alive.
+func (st *upState) running() bool {
+	return st.PID != 0 && sameProcess(st.PID, st.PIDStart)
+}
+
+// alive reports whether the service's recorded process is still the one running.
+func (s svcState) alive() bool {
+	return s.PID != 0 && sameProcess(s.PID, s.Start)
+}
+
+// sameProcess reports whether pid is alive and, if start is known, is the process
+// that started then rather than a later one that got the pid recycled.
+func sameProcess(pid int, start uint64) bool {
+	if !isProcessAlive(pid) {
+		return false
+	}
+	if start == 0 {
+		return true // recorded by a lagoon that didn't track start times
+	}
+	got, err := processStart(pid)
+	return err != nil || got == start
+}
+
+// processStart reads a process's start time, in clock ticks since boot, from /proc.
+func processStart(pid int) (uint64, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// comm can hold spaces and parens; the fields after its closing paren start at state (3)
+	i := bytes.LastIndexByte(b, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("/proc/%d/stat: unexpected format", pid)
+	}
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("/proc/%d/stat: unexpected format", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64) // starttime is field 22
+}
+
+// upRecorder keeps up.json current as the supervisor reports state changes.
+type upRecorder struct {
+	mu   sync.Mutex
+	path string
+	st   upState
+}
+
+func newUpRecorder(cacheDir, project string, names []string) *upRecorder {
+	start, _ := processStart(os.Getpid())
+	r := &upRecorder{
+		path: filepath.Join(cacheDir, upStateFile),
+		st: upState{
+			PID:      os.Getpid(),
+			PIDStart: start,
+			Project:  project,
+			Started:  time.Now().Format(time.RFC3339),
+		},
+	}
+	for _, n := range names {
+		r.st.Services = append(r.st.Services, svcState{Name: n, State: "waiting", Log: serviceLogPath(cacheDir, n)})
+	}
+	r.save()
+	return r
+}
+
+// set matches supervisor.onState. "ready" keeps the pid recorded by "running".
+func (r *upRecorder) set(name, state string, pid int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.st.Services {
+		if r.st.Services[i].Name != name {
+			continue
+		}
+		r.st.Services[i].State = state
+		if state != "ready" {
+			r.st.Services[i].PID = pid
+			r.st.Services[i].Start = 0
+			if pid != 0 {
+				r.st.Services[i].Start, _ = processStart(pid)
+			}
+		}
+	}
+	r.save()
+}
+
+// finish marks the supervisor as gone so ps stops listing it.
+func (r *upRecorder) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.st.PID = 0
+	r.save()
+}
+
+// save writes up.json. caller holds r.mu. errors are non-fatal — it's only status.
+func (r *upRecorder) save() {
+	b, _ := json.MarshalIndent(r.st, "", "  ")
+	// atomic, so ps and down never read half a file
+	_ = nix.WriteAtomic(r.path, b, 0644)
+}
+
+// serviceLogPath is where a detached service's output is appended.
+func serviceLogPath(cacheDir, name string) string {
+	return filepath.Join(cacheDir, "logs", name+".log")
+}
+
+// secretsFD is where the supervisor finds the secrets 'up -d' read for it.
+const secretsFD = 3
+
+// spawnDetached re-runs 'lagoon up' as a background supervisor in its own session,
+// so it survives the terminal closing. its own status lines go to logs/up.log.
+// secrets reach it through a pipe, never the disk or its environment.
+func spawnDetached(cacheDir, project string, secrets []sandbox.Secret) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(cacheDir, "logs"), 0755); err != nil {
+		return err
+	}
+	supLog, err := os.Create(filepath.Join(cacheDir, "logs", "up.log"))
+	if err != nil {
+		return err
+	}
+	defer supLog.Close()
+	secretsR, secretsW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	c := exec.Command(self, "up", "--supervise")
+	c.Dir = project
+	c.Stdout = supLog
+	c.Stderr = supLog
+	c.ExtraFiles = []*os.File{secretsR} // secretsFD
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = c.Start()
+	secretsR.Close()
+	if err != nil {
+		secretsW.Close()
+		return fmt.Errorf("starting supervisor: %w", err)
+	}
+	// larger than a pipe buffer would block until the supervisor reads it
+	go func() {
+		json.NewEncoder(secretsW).Encode(secrets)
+		secretsW.Close()
+	}()
+	exited := make(chan struct{})
+	go func() { c.Wait(); close(exited) }()
+
+	// success is the supervisor recording its first state, not just a started process:
+	// a bad config or a failing secret command only shows up once it runs
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	deadline := time.After(detachWait)
+	for {
+		if st, err := readUpState(cacheDir); err == nil && st.PID == c.Process.Pid {
+			return nil
+		}
+		select {
+		case <-exited:
+			msg := strings.TrimSpace(tailFile(supLog.Name(), 10))
+			if msg == "" {
+				msg = c.ProcessState.String()
+			}
+			return fmt.Errorf("background supervisor exited:\n%s", msg)
+		case <-deadline:
+			fmt.Printf("%s supervisor hasn't reported yet — see %s\n", warn("!"), supLog.Name())
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+// inheritedSecrets reads the secrets spawnDetached passed to this supervisor.
+func inheritedSecrets() ([]sandbox.Secret, error) {
+	f := os.NewFile(secretsFD, "secrets")
+	defer f.Close()
+	var secrets []sandbox.Secret
+	if err := json.NewDecoder(f).Decode(&secrets); err != nil {
+		return nil, fmt.Errorf("reading secrets from 'lagoon up -d': %w", err)
+	}
+	return secrets, nil
+}
+
+// tailFile returns the last n lines of a file, or "" if it can't be read.
+func tailFile(path string, n int) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stopPID is the same SIGTERM-then-kill sequence the supervisor uses, for a pid we didn't start.
+func stopPID(pid int) {
+	if syscall.Kill(pid, syscall.SIGTERM) != nil {
+		return
+	}
+	deadline := time.Now().Add(stopGrace)
+	for time.Now().Before(deadline) {
+		if !isProcessAlive(pid) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	syscall.Kill(pid, syscall.SIGKILL)
+}
@@ -40,7 +40,7 @@ func runDocker(cmd *cobra.Command, args []string) error {
 	cacheDir := projectCacheDir(absPath)
 	dockerNixPath := filepath.Join(cacheDir, "docker.nix")
 
-	if err := nix.GenerateDockerNix(cfg, dockerNixPath, name); err != nil {
+	if err := nix.GenerateDockerNix(cfg, absPath, dockerNixPath, name); err != nil {
 		return err
 	}
 
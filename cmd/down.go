@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var downCmd = &cobra.Command{
+	Use:   "down",
+	Short: "stop services started with 'lagoon up -d'",
+	RunE:  runDown,
+}
+
+// supervisorGrace is how long down waits for the supervisor to stop its services.
+const supervisorGrace = 10 * time.Second
+
+func runDown(cmd *cobra.Command, args []string) error {
+	absPath, err := filepath.Abs(".")
+	if err != nil {
+		return fmt.Errorf("getting working directory: %w", err)
+	}
+	st, err := readUpState(projectCacheDir(absPath))
+	if err != nil {
+		fmt.Println("no background services for this project.")
+		return nil
+	}
+
+	if st.running() {
+		// the supervisor stops every service with SIGTERM-then-kill, same as Ctrl+C on 'lagoon up'
+		syscall.Kill(st.PID, syscall.SIGTERM)
+		deadline := time.Now().Add(supervisorGrace)
+		for isProcessAlive(st.PID) && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if !isProcessAlive(st.PID) {
+			fmt.Println(ok("✓") + " stopped services")
+			return nil
+		}
+		fmt.Println(warn("!") + " supervisor didn't stop in time — killing it")
+		syscall.Kill(st.PID, syscall.SIGKILL)
+	}
+
+	// supervisor is gone; make sure nothing it started outlived it
+	stopped := 0
+	for _, svc := range st.Services {
+		if svc.alive() {
+			stopPID(svc.PID)
+			stopped++
+		}
+	}
+	if stopped == 0 && !st.running() {
+		fmt.Println("no background services running.")
+		return nil
+	}
+	fmt.Println(ok("✓") + " stopped services")
+	return nil
+}
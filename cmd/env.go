@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/nix"
+)
+
+// resolveEnv returns the environment for cfg, from cache when possible, and
+// registers its gc roots. the returned sum identifies the generated shell.nix or flake.
+func resolveEnv(cfg *config.Config, absPath string) (*nix.ResolvedEnv, string, error) {
+	src, err := nix.Prepare(cfg, envBase(), absPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// one resolve per env at a time — a second lagoon waits here, then finds it cached
+	unlock, err := nix.LockEnv(src.Dir, func() {
+		fmt.Println(warn("!") + " waiting for another lagoon to finish building this environment")
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("locking environment cache: %w", err)
+	}
+	defer unlock()
+
+	// write shell.nix or flake.nix (skips write if content unchanged)
+	if err := src.Write(); err != nil {
+		return nil, "", err
+	}
+
+	// warm start: skip nix entirely if this or any other project already built the env
+	resolved, hit := nix.LoadCache(src.Dir, src.Sum)
+
+	// nix-collect-garbage can wipe store paths even when the cache file is valid
+	if hit {
+		if _, err := os.Stat(resolved.BashPath); err != nil {
+			hit = false
+		}
+	}
+
+	if !hit {
+		// arm warning only matters on cold starts — warm starts are instant
+		if runtime.GOARCH == "arm64" {
+			fmt.Println(warn("!") + " arm: first run may take 10-60 min to compile packages")
+			fmt.Println("  this only happens once. subsequent runs start in under a second.")
+		}
+
+		// run nix with a bubbletea spinner showing live progress
+		env, err := resolveWithProgress(src)
+		if err != nil {
+			return nil, "", err
+		}
+		resolved = env
+		_ = nix.SaveCache(src.Dir, resolved, src.Sum)
+	} else {
+		fmt.Println(ok("✓") + " environment ready")
+	}
+
+	// always register gc roots so nix-collect-garbage won't wipe the env on next warm start
+	nix.CreateGCRoots(src.Dir, resolved)
+	_ = linkEnv(projectCacheDir(absPath), absPath, src.Dir)
+	return resolved, src.Sum, nil
+}
+
+// langNames lists the language sections for display, e.g. "python311 (+2)".
+func langNames(cfg *config.Config) []string {
+	var names []string
+	for _, l := range cfg.Langs() {
+		name := l.Attr()
+		if n := len(l.Packages); n > 0 {
+			name += fmt.Sprintf(" (+%d)", n)
+		}
+		names = append(names, name)
+	}
+	return names
+}
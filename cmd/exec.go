@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/nix"
+	"github.com/imraghavojha/lagoon/internal/sandbox"
+	"github.com/spf13/cobra"
+)
+
+var (
+	execEnvFlags []string
+	execPIDFlag  int
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec [command]",
+	Short: "open a shell (or run a command) inside this project's running sandbox",
+	Long: `lagoon exec
+lagoon exec python3 manage.py shell
+
+Joins the namespaces of the sandbox started by 'lagoon shell' in this project,
+so a second terminal shares its /tmp, processes and network state.
+With no command, opens an interactive shell. When the project has several
+sandboxes running, pick one with --pid or from the list.`,
+	RunE: runExec,
+}
+
+func init() {
+	execCmd.Flags().StringArrayVarP(&execEnvFlags, "env", "e", nil, "set env var in sandbox (KEY=VALUE)")
+	execCmd.Flags().IntVar(&execPIDFlag, "pid", 0, "join the sandbox with this pid, as 'lagoon ps' lists it")
+}
+
+func runExec(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Read(config.Filename)
+	if err != nil {
+		return fmt.Errorf("no lagoon.toml — run 'lagoon init' first")
+	}
+
+	absPath, err := filepath.Abs(".")
+	if err != nil {
+		return fmt.Errorf("getting working directory: %w", err)
+	}
+	cacheDir := projectCacheDir(absPath)
+
+	pid, err := pickSandbox(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	// the running sandbox was started from this env, so the cache is always warm here
+	src, err := nix.Prepare(cfg, envBase(), absPath)
+	if err != nil {
+		return err
+	}
+	resolved, hit := nix.LoadCache(src.Dir, src.Sum)
+	if !hit {
+		return fmt.Errorf("lagoon.toml changed since the sandbox started — exit it and run 'lagoon shell' again")
+	}
+
+	envs, err := sandboxEnvs(cfg, absPath, execEnvFlags)
+	if err != nil {
+		return err
+	}
+	// the proxy is already listening inside the shared network namespace
+	if cfg.Profile == "allowlist" {
+		envs = append(proxyEnv(), envs...)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s joining sandbox (pid %d)\n", ok("→"), pid)
+	return sandbox.Join(cfg, resolved, pid, sandbox.Options{
+		Cmd:       shellQuoteArgs(args),
+		ExtraEnvs: envs,
+	})
+}
+
+// pickSandbox returns the child pid of the sandbox to join: the one --pid names, the
+// only one running, or the one the user picks.
+func pickSandbox(cacheDir string) (int, error) {
+	children := map[int]int{} // lagoon pid → bwrap child pid
+	var running []sandboxPID
+	for _, s := range liveSandboxes(cacheDir) {
+		// the info file is written once bwrap is up; a recycled pid has none that's sandboxed
+		if pid, err := sandbox.ReadInfo(infoPath(cacheDir, s.PID)); err == nil && sandbox.IsSandboxed(pid) {
+			children[s.PID] = pid
+			running = append(running, s)
+		}
+	}
+	switch {
+	case len(running) == 0:
+		return 0, fmt.Errorf("no running sandbox for this project — start one with 'lagoon shell'")
+	case execPIDFlag != 0:
+		if pid, found := children[execPIDFlag]; found {
+			return pid, nil
+		}
+		return 0, fmt.Errorf("no sandbox with pid %d in this project — see 'lagoon ps'", execPIDFlag)
+	case len(running) == 1:
+		return children[running[0].PID], nil
+	}
+
+	options := make([]huh.Option[int], len(running))
+	for i, s := range running {
+		started := s.Started
+		if t, err := time.Parse(time.RFC3339, s.Started); err == nil {
+			started = t.Format("15:04:05")
+		}
+		options[i] = huh.NewOption(fmt.Sprintf("pid %-6d  started %s", s.PID, started), s.PID)
+	}
+	var chosen int
+	if err := huh.NewSelect[int]().
+		Title(fmt.Sprintf("%d sandboxes are running for this project — join which?", len(running))).
+		Options(options...).
+		Value(&chosen).
+		Run(); err != nil {
+		return 0, fmt.Errorf("%d sandboxes are running for this project — pick one with --pid", len(running))
+	}
+	return children[chosen], nil
+}
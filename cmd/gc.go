@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imraghavojha/lagoon/internal/nix"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcDryRun    bool
+	gcOlderThan string
+	gcStore     bool
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "remove cache entries and gc roots of deleted or unused projects",
+	Long: `lagoon gc
+lagoon gc --dry-run --older-than 30d
+lagoon gc --store
+
+Every resolved environment keeps its whole closure alive as nix gc roots. gc
+drops projects whose directory is gone (or, with --older-than, that haven't
+resolved for that long), then every environment no remaining project uses,
+along with its roots. With --store it runs nix-store --gc afterwards to actually
+free the disk space. Projects with a running sandbox or services are kept.`,
+	Args: cobra.NoArgs,
+	RunE: runGC,
+}
+
+func init() {
+	gcCmd.Flags().BoolVarP(&gcDryRun, "dry-run", "n", false, "list what would be removed and how much it frees")
+	gcCmd.Flags().StringVar(&gcOlderThan, "older-than", "", "also remove projects unused for this long (e.g. 30d, 12h)")
+	gcCmd.Flags().BoolVar(&gcStore, "store", false, "run nix-store --gc after removing roots")
+}
+
+// gcGrace protects environments and project dirs created moments ago — a resolve
+// may still be linking them.
+const gcGrace = time.Hour
+
+// projectDirRe matches the per-project cache dirs projectCacheDir creates.
+var projectDirRe = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+func runGC(cmd *cobra.Command, args []string) error {
+	var maxAge time.Duration
+	if gcOlderThan != "" {
+		d, err := parseAge(gcOlderThan)
+		if err != nil {
+			return err
+		}
+		maxAge = d
+	}
+	base := lagoonCacheBase()
+
+	// projects first: what's left of them decides which environments are still in use
+	entries, _ := os.ReadDir(base)
+	var dropDirs, dropLines []string
+	for _, e := range entries {
+		if !e.IsDir() || !projectDirRe.MatchString(e.Name()) {
+			continue
+		}
+		dir := filepath.Join(base, e.Name())
+		if why := staleProject(dir, maxAge); why != "" {
+			dropDirs = append(dropDirs, dir)
+			dropLines = append(dropLines, why)
+		}
+	}
+	dropped := map[string]bool{}
+	for _, d := range dropDirs {
+		dropped[d] = true
+	}
+	inUse := map[string]bool{}
+	for _, u := range envUses() {
+		if !dropped[u.Dir] {
+			inUse[u.Sum] = true
+		}
+	}
+	var dropEnvs []string
+	// locks are held until the dirs are gone, so no resolve can start on one
+	// between the check and the removal
+	var unlocks []func()
+	defer func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}()
+	envs, _ := os.ReadDir(envBase())
+	for _, e := range envs {
+		info, err := e.Info()
+		if err != nil || !e.IsDir() || inUse[e.Name()] || time.Since(info.ModTime()) < gcGrace {
+			continue
+		}
+		// a long build holds the lock the whole time; leave it be
+		unlock, free := nix.TryLockEnv(filepath.Join(envBase(), e.Name()))
+		if !free {
+			continue
+		}
+		unlocks = append(unlocks, unlock)
+		dropEnvs = append(dropEnvs, filepath.Join(envBase(), e.Name()))
+		dropLines = append(dropLines, fmt.Sprintf("env      %s  (no projects left)", e.Name()))
+	}
+
+	if len(dropLines) == 0 {
+		fmt.Println(ok("✓") + " nothing to collect")
+		return maybeStoreGC()
+	}
+
+	// the freed size is what only the dropped roots were keeping alive
+	kept := map[string]bool{}
+	for sum := range inUse {
+		for _, p := range rootTargets(filepath.Join(envBase(), sum)) {
+			kept[p] = true
+		}
+	}
+	freed := map[string]bool{}
+	for _, dir := range append(dropDirs, dropEnvs...) {
+		for _, p := range rootTargets(dir) {
+			if !kept[p] {
+				freed[p] = true
+			}
+		}
+	}
+	size := storeSize(freed)
+
+	verb := "would remove"
+	if !gcDryRun {
+		verb = "removed"
+		for _, dir := range append(dropDirs, dropEnvs...) {
+			if err := os.RemoveAll(dir); err != nil {
+				return fmt.Errorf("removing %s: %w", dir, err)
+			}
+		}
+	}
+	fmt.Println("  " + verb + ":")
+	for _, line := range dropLines {
+		fmt.Println("    " + line)
+	}
+	fmt.Println()
+	if gcDryRun {
+		fmt.Printf("  up to %s in the nix store would become collectable (%d paths)\n", humanBytes(size), len(freed))
+		fmt.Println("  run without --dry-run to remove them; add --store to free the space")
+		return nil
+	}
+	fmt.Printf("%s up to %s in the nix store is now collectable (%d paths)\n", ok("✓"), humanBytes(size), len(freed))
+	if !gcStore {
+		fmt.Println("  run 'lagoon gc --store' or 'nix-store --gc' to free it")
+	}
+	return maybeStoreGC()
+}
+
+// staleProject says why the project cache dir should go, or "" to keep it.
+func staleProject(dir string, maxAge time.Duration) string {
+	if projectRunning(dir) {
+		return ""
+	}
+	// a dir made moments ago may not have its project file yet
+	if info, err := os.Stat(dir); err != nil || time.Since(info.ModTime()) < gcGrace {
+		return ""
+	}
+	b, err := os.ReadFile(filepath.Join(dir, projectFile))
+	if err != nil {
+		// written before environments were shared — its env.json and roots are orphans now
+		return fmt.Sprintf("project  %s  (old cache layout)", filepath.Base(dir))
+	}
+	project := strings.TrimSpace(string(b))
+	if _, err := os.Stat(project); os.IsNotExist(err) {
+		return fmt.Sprintf("project  %s  (gone)", project)
+	}
+	if maxAge > 0 {
+		if info, err := os.Lstat(filepath.Join(dir, envLink)); err == nil && time.Since(info.ModTime()) > maxAge {
+			days := int(time.Since(info.ModTime()).Hours() / 24)
+			return fmt.Sprintf("project  %s  (unused %d days)", project, days)
+		}
+	}
+	return ""
+}
+
+// projectRunning reports whether a sandbox or detached services still use dir.
+func projectRunning(dir string) bool {
+	if st, err := readUpState(dir); err == nil && st.running() {
+		return true
+	}
+	return len(liveSandboxes(dir)) > 0
+}
+
+// rootTargets lists the store paths dir's gcroots point at.
+func rootTargets(dir string) []string {
+	links, _ := filepath.Glob(filepath.Join(dir, "gcroots", "*"))
+	var paths []string
+	for _, l := range links {
+		if p, err := os.Readlink(l); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// storeSize adds up the nar size of paths that are still in the store.
+func storeSize(paths map[string]bool) int64 {
+	var valid []string
+	for p := range paths {
+		if _, err := os.Lstat(p); err == nil {
+			valid = append(valid, p)
+		}
+	}
+	sort.Strings(valid)
+	var total int64
+	// batches keep the argument list well under ARG_MAX
+	for len(valid) > 0 {
+		n := min(len(valid), 500)
+		out, err := exec.Command("nix-store", append([]string{"-q", "--size"}, valid[:n]...)...).Output()
+		if err == nil {
+			for _, f := range strings.Fields(string(out)) {
+				size, _ := strconv.ParseInt(f, 10, 64)
+				total += size
+			}
+		}
+		valid = valid[n:]
+	}
+	return total
+}
+
+// maybeStoreGC runs nix-store --gc when --store was given.
+func maybeStoreGC() error {
+	if !gcStore || gcDryRun {
+		return nil
+	}
+	fmt.Println(ok("→") + " nix-store --gc")
+	c := exec.Command("nix-store", "--gc")
+	c.Stdout, c.Stderr = os.Stdout, os.Stderr
+	return c.Run()
+}
+
+// parseAge accepts a Go duration or a whole number of days, e.g. "30d".
+func parseAge(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("--older-than %q: must be like 30d or 12h", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("--older-than %q: must be like 30d or 12h", s)
+	}
+	return d, nil
+}
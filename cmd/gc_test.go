@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "30d", want: 30 * 24 * time.Hour},
+		{in: "1d", want: 24 * time.Hour},
+		{in: "12h", want: 12 * time.Hour},
+		{in: "90m", want: 90 * time.Minute},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "0d", wantErr: true},
+		{in: "-3d", wantErr: true},
+		{in: "1.5d", wantErr: true},
+		{in: "0s", wantErr: true},
+		{in: "-1h", wantErr: true},
+		{in: "30", wantErr: true},
+		{in: "1w", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseAge(tt.in)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "must be like 30d or 12h")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStaleProject(t *testing.T) {
+	old := time.Now().Add(-2 * gcGrace)
+	project := t.TempDir()
+	tests := []struct {
+		name   string
+		setup  func(dir string)
+		maxAge time.Duration
+		want   string
+	}{
+		{
+			name:  "fresh dir without project file",
+			setup: func(dir string) {},
+			want:  "",
+		},
+		{
+			name:  "old dir without project file",
+			setup: func(dir string) { os.Chtimes(dir, old, old) },
+			want:  "old cache layout",
+		},
+		{
+			name: "project gone",
+			setup: func(dir string) {
+				os.WriteFile(filepath.Join(dir, projectFile), []byte(filepath.Join(project, "missing")), 0644)
+				os.Chtimes(dir, old, old)
+			},
+			want: "(gone)",
+		},
+		{
+			name: "project gone but dir fresh",
+			setup: func(dir string) {
+				os.WriteFile(filepath.Join(dir, projectFile), []byte(filepath.Join(project, "missing")), 0644)
+			},
+			want: "",
+		},
+		{
+			name: "project present",
+			setup: func(dir string) {
+				os.WriteFile(filepath.Join(dir, projectFile), []byte(project), 0644)
+				os.Chtimes(dir, old, old)
+			},
+			want: "",
+		},
+		{
+			name: "unused too long",
+			setup: func(dir string) {
+				os.WriteFile(filepath.Join(dir, projectFile), []byte(project), 0644)
+				os.Symlink("/nonexistent", filepath.Join(dir, envLink))
+				os.Chtimes(dir, old, old)
+			},
+			maxAge: time.Nanosecond,
+			want:   "unused 0 days",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "0123abcd")
+			require.NoError(t, os.Mkdir(dir, 0755))
+			tt.setup(dir)
+			got := staleProject(dir, tt.maxAge)
+			if tt.want == "" {
+				assert.Empty(t, got)
+			} else {
+				assert.Contains(t, got, tt.want)
+			}
+		})
+	}
+}
@@ -79,7 +79,7 @@ func runInit(cmd *cobra.Command, args []string) error {
 	}
 
 	cfg := &config.Config{
-		Packages:      packages,
+		Packages:      config.Packages(packages...),
 		NixpkgsCommit: config.DefaultCommit,
 		NixpkgsSHA256: config.DefaultSHA256,
 		Profile:       profile,
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/imraghavojha/lagoon/internal/nix"
+	"github.com/spf13/cobra"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "manage the signing keys for bundles",
+	Long: `lagoon keys generate|list
+
+Keys are ed25519 in nix's format (name:base64), the same as
+nix-store --generate-binary-cache-key makes, so either tool's keys work with
+the other. They live in ~/.config/lagoon/keys as <name>.sec and <name>.pub.
+
+  lagoon save --sign build-1 > env.bundle
+  lagoon load --require-signature build-1:BASE64… env.bundle`,
+}
+
+var keysGenerateCmd = &cobra.Command{
+	Use:   "generate [name]",
+	Short: "create a signing key pair (default name: <hostname>-1)",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runKeysGenerate,
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list keys and their public halves",
+	Args:  cobra.NoArgs,
+	RunE:  runKeysList,
+}
+
+func init() {
+	keysCmd.AddCommand(keysGenerateCmd, keysListCmd)
+}
+
+// keysDir is outside the cache dir so nothing that cleans caches can lose a key.
+func keysDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "lagoon", "keys"), nil
+}
+
+func runKeysGenerate(cmd *cobra.Command, args []string) error {
+	var name string
+	if len(args) == 1 {
+		name = args[0]
+	} else {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("no key name given and no hostname: %w", err)
+		}
+		name = host + "-1"
+	}
+	key, err := nix.GenerateKey(name)
+	if err != nil {
+		return err
+	}
+	dir, err := keysDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	sec := filepath.Join(dir, name+".sec")
+	// O_EXCL: never replace a key bundles may already be signed with
+	f, err := os.OpenFile(sec, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return fmt.Errorf("key %q already exists in %s", name, dir)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(key.String())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(sec)
+		return err
+	}
+	pub := key.Public().String()
+	if err := os.WriteFile(filepath.Join(dir, name+".pub"), []byte(pub), 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s created key %s\n", ok("✓"), name)
+	fmt.Printf("  secret: %s\n", sec)
+	fmt.Printf("  public: %s\n\n", pub)
+	fmt.Println("  sign:   lagoon save --sign " + name + " > env.bundle")
+	fmt.Println("  verify: lagoon load --require-signature " + pub + " env.bundle")
+	return nil
+}
+
+func runKeysList(cmd *cobra.Command, args []string) error {
+	dir, err := keysDir()
+	if err != nil {
+		return err
+	}
+	pubs, _ := filepath.Glob(filepath.Join(dir, "*.pub"))
+	if len(pubs) == 0 {
+		fmt.Println("  no keys — run 'lagoon keys generate'")
+		return nil
+	}
+	sort.Strings(pubs)
+	for _, p := range pubs {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		key, err := nix.ParsePublicKey(string(b))
+		if err != nil {
+			fmt.Printf("  %s %s: %v\n", warn("!"), filepath.Base(p), err)
+			continue
+		}
+		mark := "verify only"
+		if _, err := os.Stat(strings.TrimSuffix(p, ".pub") + ".sec"); err == nil {
+			mark = "can sign"
+		}
+		fmt.Printf("  %-24s  %-11s  %s\n", key.Name, mark, key)
+	}
+	return nil
+}
+
+// readSecretKey loads a signing key from a file, or by name from keysDir.
+func readSecretKey(arg string) (*nix.SecretKey, error) {
+	path := arg
+	if _, err := os.Stat(path); err != nil {
+		dir, derr := keysDir()
+		if derr != nil {
+			return nil, derr
+		}
+		path = filepath.Join(dir, arg+".sec")
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no key file %s and no key named %q — see 'lagoon keys list'", arg, arg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nix.ParseSecretKey(string(b))
+}
+
+// readPublicKey accepts a key itself (name:base64), a file holding one, or the
+// name of a key in keysDir.
+func readPublicKey(arg string) (*nix.PublicKey, error) {
+	if key, err := nix.ParsePublicKey(arg); err == nil {
+		return key, nil
+	}
+	path := arg
+	if _, err := os.Stat(path); err != nil {
+		dir, derr := keysDir()
+		if derr != nil {
+			return nil, derr
+		}
+		path = filepath.Join(dir, arg+".pub")
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%q is not a public key, a key file or a key name — see 'lagoon keys list'", arg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nix.ParsePublicKey(string(b))
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// resource limit flags, shared by shell and run
+var (
+	memFlag      string
+	cpusFlag     float64
+	pidsMaxFlag  int
+	ioWeightFlag int
+)
+
+// addLimitFlags registers the resource limit flags on c.
+func addLimitFlags(c *cobra.Command) {
+	c.Flags().StringVarP(&memFlag, "memory", "m", "", "limit sandbox memory (e.g. 512m, 1g)")
+	c.Flags().Float64Var(&cpusFlag, "cpus", 0, "limit sandbox CPU time, in cores (e.g. 1.5)")
+	c.Flags().IntVar(&pidsMaxFlag, "pids-max", 0, "limit the number of processes and threads in the sandbox")
+	c.Flags().IntVar(&ioWeightFlag, "io-weight", 0, "disk I/O share relative to other sandboxes (1-10000, default 100)")
+}
+
+// sandboxLimits is the [limits] table with any limit flags layered on top.
+func sandboxLimits(cfg *config.Config) (config.Limits, error) {
+	l := cfg.Limits.Merge(config.Limits{Memory: memFlag, CPUs: cpusFlag, PidsMax: pidsMaxFlag, IOWeight: ioWeightFlag})
+	return l, l.Check()
+}
+
+// limitsBanner describes l for the shell banner, e.g. " │ mem: 512M │ cpus: 1.5".
+func limitsBanner(l config.Limits) string {
+	var s string
+	if l.Memory != "" {
+		s += " │ mem: " + strings.ToUpper(l.Memory)
+	}
+	if l.CPUs != 0 {
+		s += fmt.Sprintf(" │ cpus: %g", l.CPUs)
+	}
+	if l.PidsMax != 0 {
+		s += fmt.Sprintf(" │ pids: %d", l.PidsMax)
+	}
+	if l.IOWeight != 0 {
+		s += fmt.Sprintf(" │ io: %d", l.IOWeight)
+	}
+	return s
+}
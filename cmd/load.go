@@ -3,16 +3,43 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
 
+	"github.com/imraghavojha/lagoon/internal/bundle"
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/nix"
 	"github.com/spf13/cobra"
 )
 
 var loadCmd = &cobra.Command{
 	Use:   "load <file>",
-	Short: "import an environment from a .nar file",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runLoad,
+	Short: "import an environment from a bundle made by lagoon save",
+	Long: `lagoon load myenv.bundle
+
+Checks the bundle's manifest (zstd and gzip bundles are detected and
+decompressed on the fly), imports every store path while verifying it
+against the sha256 recorded at save time, and seeds the environment cache so
+the first 'lagoon shell' starts without running nix. A path that fails
+verification is never added to the store. A bundle saved with --since or
+--exclude-from only loads once the store paths it left out are present.
+Run it in an empty directory, or pass --write-config, to get the bundle's
+lagoon.toml written there too.
+
+With --require-signature, a bundle must be signed by one of the given keys,
+checked before anything is imported.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runLoad,
+}
+
+var (
+	loadRequireSignature []string
+	loadWriteConfig      bool
+)
+
+func init() {
+	loadCmd.Flags().StringArrayVar(&loadRequireSignature, "require-signature", nil, "only load bundles signed by this public key, key file or key name (repeatable; any one will do)")
+	loadCmd.Flags().BoolVar(&loadWriteConfig, "write-config", false, "write the bundle's lagoon.toml here even if the directory isn't empty")
 }
 
 func runLoad(cmd *cobra.Command, args []string) error {
@@ -22,11 +49,117 @@ func runLoad(cmd *cobra.Command, args []string) error {
 	}
 	defer f.Close()
 
-	fmt.Fprintln(os.Stderr, ok("→")+" importing from "+args[0]+"…")
+	var count byteCount
+	var total int64
+	if info, err := f.Stat(); err == nil {
+		total = info.Size()
+	}
+	plain, err := bundle.Decompress(countingReader{f, &count})
+	if err != nil {
+		return err
+	}
+	defer plain.Close()
+
+	r, err := bundle.NewReader(plain)
+	if err != nil {
+		return err
+	}
+	m := r.Manifest
+
+	// checked first: nothing from an untrusted bundle touches the store or the lock check
+	if len(loadRequireSignature) > 0 {
+		var trusted []*nix.PublicKey
+		for _, arg := range loadRequireSignature {
+			key, err := readPublicKey(arg)
+			if err != nil {
+				return err
+			}
+			trusted = append(trusted, key)
+		}
+		key, err := r.Verify(trusted)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, ok("✓")+" signed by "+key.Name)
+	} else if len(r.Signatures) > 0 {
+		fmt.Fprintln(os.Stderr, warn("!")+" bundle is signed but not checked — pass --require-signature to verify it")
+	}
+
+	// a committed lock says exactly which closure this project expects
+	if l, err := nix.ReadLock(nix.LockFilename); err == nil && l.Sum == m.Sum && l.Entry() != nil && l.Entry().ClosureSHA256 != m.ClosureSHA256 {
+		return fmt.Errorf("bundle doesn't match %s\n  lock:   %s\n  bundle: %s", nix.LockFilename, l.Entry().ClosureSHA256, m.ClosureSHA256)
+	}
+
+	// an incremental bundle is only complete on top of what it was made against
+	missing, err := m.MissingPrerequisites()
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		shown := missing[:min(len(missing), 5)]
+		more := ""
+		if len(missing) > len(shown) {
+			more = fmt.Sprintf("\n    … and %d more", len(missing)-len(shown))
+		}
+		return fmt.Errorf("%d prerequisite store paths are missing — load the bundle this one was saved against first\n    %s%s",
+			len(missing), strings.Join(shown, "\n    "), more)
+	}
+	if len(m.Prerequisites) > 0 {
+		fmt.Fprintf(os.Stderr, "%s all %d prerequisite store paths present\n", ok("✓"), len(m.Prerequisites))
+	}
 
-	imp := exec.Command("nix-store", "--import")
-	imp.Stdin = f
-	imp.Stdout = os.Stdout
-	imp.Stderr = os.Stderr
-	return imp.Run()
+	fmt.Fprintln(os.Stderr, ok("→")+" importing "+fmt.Sprint(len(m.Paths))+" store paths from "+args[0]+"…")
+	if err := withTransferProgress("loading", total, &count, r.Import); err != nil {
+		return err
+	}
+	if _, err := os.Stat(m.Env.BashPath); err != nil {
+		return fmt.Errorf("imported environment has no bash at %s", m.Env.BashPath)
+	}
+	fmt.Fprintln(os.Stderr, ok("✓")+" verified closure sha256 "+m.ClosureSHA256)
+
+	envDir := filepath.Join(envBase(), m.Sum)
+	unlock, err := nix.LockEnv(envDir, nil)
+	if err != nil {
+		return fmt.Errorf("locking environment cache: %w", err)
+	}
+	defer unlock()
+	if err := nix.SaveCache(envDir, &m.Env, m.Sum); err != nil {
+		return fmt.Errorf("seeding environment cache: %w", err)
+	}
+	nix.CreateGCRoots(envDir, &m.Env)
+
+	return adoptBundleConfig(m)
+}
+
+// adoptBundleConfig writes the bundle's lagoon.toml into an empty directory, or any
+// directory without one under --write-config, and says whether the project here
+// will pick up the loaded environment.
+func adoptBundleConfig(m *bundle.Manifest) error {
+	if _, err := os.Stat(config.Filename); os.IsNotExist(err) {
+		// a directory with files in it is some other project — don't make it a lagoon one
+		if entries, _ := os.ReadDir("."); len(entries) > 0 && !loadWriteConfig {
+			fmt.Fprintln(os.Stderr, "  run 'lagoon load --write-config' to also write the bundle's "+config.Filename+" here")
+			return nil
+		}
+		if err := os.WriteFile(config.Filename, []byte(m.Config), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, ok("✓")+" wrote "+config.Filename+" from the bundle")
+	}
+	// the store and cache are loaded either way; this only decides what to tell the user
+	cfg, err := config.Read(config.Filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, warn("!")+" "+config.Filename+": "+err.Error())
+		return nil
+	}
+	absPath, _ := filepath.Abs(".")
+	src, err := nix.Prepare(cfg, envBase(), absPath)
+	if err != nil || src.Sum != m.Sum {
+		fmt.Fprintln(os.Stderr, warn("!")+" this project's "+config.Filename+" differs from the bundle's — 'lagoon shell' here will rebuild")
+		fmt.Fprintln(os.Stderr, "  the loaded environment is used by any project whose lagoon.toml matches it")
+		return nil
+	}
+	_ = linkEnv(projectCacheDir(absPath), absPath, src.Dir)
+	fmt.Fprintln(os.Stderr, ok("✓")+" environment cached — 'lagoon shell' starts instantly")
+	return nil
 }
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/nix"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ignoreLockFlag bool
+	updateLockFlag bool
+)
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "resolve the environment and record it in lagoon.lock",
+	Long: `Resolves the environment lagoon.toml describes and writes lagoon.lock from
+it, replacing any existing lock. Run it after changing lagoon.toml, then
+commit both files. shell and run only write lagoon.lock when there is none.`,
+	RunE: runLock,
+}
+
+// addLockFlags registers --ignore-lock and --update-lock on a command that checks lagoon.lock.
+func addLockFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&ignoreLockFlag, "ignore-lock", false, "warn instead of failing when the environment differs from lagoon.lock")
+	cmd.Flags().BoolVar(&updateLockFlag, "update-lock", false, "rewrite lagoon.lock from this environment instead of checking it")
+	cmd.MarkFlagsMutuallyExclusive("ignore-lock", "update-lock")
+}
+
+func runLock(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Read(config.Filename)
+	if err != nil {
+		return fmt.Errorf("no lagoon.toml — run 'lagoon init' first")
+	}
+	absPath, err := filepath.Abs(".")
+	if err != nil {
+		return fmt.Errorf("getting working directory: %w", err)
+	}
+	resolved, sum, err := resolveEnv(cfg, absPath)
+	if err != nil {
+		return err
+	}
+	return writeLock(cfg, resolved, sum)
+}
+
+// checkLock compares the resolved environment against lagoon.lock. a missing lock,
+// or a missing entry for this system, is written; an existing one is only replaced
+// when update is set. a lock for a different lagoon.toml, or one whose paths
+// disagree, is an error unless ignore is set.
+func checkLock(cfg *config.Config, resolved *nix.ResolvedEnv, sum string, ignore, update bool) error {
+	lock, err := nix.ReadLock(nix.LockFilename)
+	switch {
+	case errors.Is(err, fs.ErrNotExist), err == nil && update:
+		if err := writeLock(cfg, resolved, sum); err != nil {
+			fmt.Println(warn("!") + " " + err.Error())
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("reading %s: %w", nix.LockFilename, err)
+	}
+
+	if lock.Sum == sum && lock.Entry() == nil {
+		// first machine of its kind — nothing to compare against yet
+		if err := lock.Record(resolved); err == nil {
+			err = nix.WriteLock(nix.LockFilename, lock)
+		}
+		if err != nil {
+			fmt.Println(warn("!") + " could not write " + nix.LockFilename + ": " + err.Error())
+			return nil
+		}
+		fmt.Println(ok("✓") + " added " + nix.System() + " to " + nix.LockFilename + " — commit it")
+		return nil
+	}
+
+	var b strings.Builder
+	if lock.Sum != sum {
+		b.WriteString("lagoon.toml changed since " + nix.LockFilename + " was written\n")
+	} else {
+		missing, extra, err := lock.Verify(resolved, filepath.Join(envBase(), sum))
+		if err == nil && len(missing) == 0 && len(extra) == 0 {
+			return nil
+		}
+		if err != nil {
+			b.WriteString(err.Error() + "\n")
+		} else {
+			b.WriteString("this machine resolved different store paths than " + nix.LockFilename + "\n")
+		}
+		for _, p := range missing {
+			b.WriteString("  - " + p + "\n")
+		}
+		for _, p := range extra {
+			b.WriteString("  + " + p + "\n")
+		}
+	}
+	if ignore {
+		fmt.Println(warn("!") + " " + strings.TrimRight(b.String(), "\n"))
+		return nil
+	}
+	if lock.Sum != sum {
+		b.WriteString("  run 'lagoon lock' to record the new environment, or pass --ignore-lock to enter anyway")
+	} else {
+		b.WriteString("  check nix.conf overlays/substituters, or pass --ignore-lock to enter anyway")
+	}
+	return errors.New(b.String())
+}
+
+// writeLock records resolved in lagoon.lock. other systems' entries are kept
+// while lagoon.toml is unchanged; they're dropped once it isn't.
+func writeLock(cfg *config.Config, resolved *nix.ResolvedEnv, sum string) error {
+	lock, err := nix.ReadLock(nix.LockFilename)
+	if err == nil && lock.Sum == sum {
+		err = lock.Record(resolved)
+	} else {
+		lock, err = nix.NewLock(resolved, sum, cfg.NixpkgsCommit)
+	}
+	if err == nil {
+		err = nix.WriteLock(nix.LockFilename, lock)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", nix.LockFilename, err)
+	}
+	fmt.Println(ok("✓") + " wrote " + nix.LockFilename + " — commit it alongside lagoon.toml")
+	return nil
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	followFlag bool
+	tailFlag   int
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [service]",
+	Short: "show output of services started with 'lagoon up -d'",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runLogs,
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&followFlag, "follow", "f", false, "keep printing new output until the services stop")
+	logsCmd.Flags().IntVarP(&tailFlag, "tail", "n", 0, "only show the last N lines of each service (0 = all)")
+}
+
+// logPoll is how often -f checks the log files for new output.
+const logPoll = 250 * time.Millisecond
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	absPath, err := filepath.Abs(".")
+	if err != nil {
+		return fmt.Errorf("getting working directory: %w", err)
+	}
+	st, err := readUpState(projectCacheDir(absPath))
+	if err != nil {
+		return fmt.Errorf("no background services for this project — start them with 'lagoon up -d'")
+	}
+
+	// colors follow start order, same as the foreground 'lagoon up'
+	width := 0
+	for _, svc := range st.Services {
+		width = max(width, len(svc.Name))
+	}
+	var wg sync.WaitGroup
+	found := false
+	for i, svc := range st.Services {
+		if len(args) == 1 && svc.Name != args[0] {
+			continue
+		}
+		found = true
+		prefix := svcStyle(i).Render(fmt.Sprintf("%-*s", width, svc.Name)+" |") + " "
+		f, err := os.Open(svc.Log)
+		if err != nil {
+			continue // service never started, so never wrote anything
+		}
+		defer f.Close()
+		r := bufio.NewReader(f)
+		printTail(r, prefix, tailFlag)
+		if followFlag {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				followLog(r, prefix, st)
+			}()
+		}
+	}
+	if !found {
+		return fmt.Errorf("no service %q in this project", args[0])
+	}
+	wg.Wait()
+	return nil
+}
+
+// printTail prints what's currently in r, or only its last n lines if n > 0.
+func printTail(r *bufio.Reader, prefix string, n int) {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if line != "" {
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for _, l := range lines {
+		fmt.Println(prefix + l)
+	}
+}
+
+// followLog prints lines appended to r until the supervisor exits.
+func followLog(r *bufio.Reader, prefix string, st *upState) {
+	var partial string
+	for {
+		line, err := r.ReadString('\n')
+		partial += line
+		if err == nil {
+			fmt.Println(prefix + strings.TrimSuffix(partial, "\n"))
+			partial = ""
+			continue
+		}
+		if err != io.EOF || !st.running() {
+			if partial != "" {
+				fmt.Println(prefix + partial)
+			}
+			return
+		}
+		time.Sleep(logPoll)
+	}
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/sandbox"
+)
+
+// sandboxBinds returns every extra mount for a sandbox: [volumes], [[mounts]]
+// and --mount flags, sorted so parent targets are mounted before their children.
+func sandboxBinds(cfg *config.Config, projectPath string, flags []string) ([]sandbox.Bind, error) {
+	binds, err := volumeBinds(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mounts := append([]config.Mount(nil), cfg.Mounts...)
+	for _, spec := range flags {
+		m, err := config.ParseMount(spec)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, m)
+	}
+	for _, m := range mounts {
+		src, err := mountSource(m, projectPath)
+		if err != nil {
+			return nil, err
+		}
+		binds = append(binds, sandbox.Bind{Source: src, Target: m.Target, ReadOnly: m.ReadOnly()})
+	}
+	// "~/x" and "/home/u/x" are the same place, so compare where they land
+	sort.SliceStable(binds, func(i, j int) bool {
+		return sandbox.TargetPath(binds[i].Target) < sandbox.TargetPath(binds[j].Target)
+	})
+	return binds, nil
+}
+
+// mountSource validates m and resolves its source to an existing absolute host path.
+// "~/" means the host home here — the sandbox home only applies to targets.
+func mountSource(m config.Mount, projectPath string) (string, error) {
+	if err := m.Check(); err != nil {
+		return "", err
+	}
+	src := m.Source
+	if strings.HasPrefix(src, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("mount %q: %w", m.Source, err)
+		}
+		src = filepath.Join(home, src[2:])
+	} else if !filepath.IsAbs(src) {
+		src = filepath.Join(projectPath, src)
+	}
+	if _, err := os.Stat(src); err != nil {
+		return "", fmt.Errorf("mount %q: source does not exist (%s)", m.Source, src)
+	}
+	return src, nil
+}
@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"debug/elf"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/netproxy"
+	"github.com/imraghavojha/lagoon/internal/sandbox"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// helperDir is where the lagoon binary and its sockets appear inside the sandbox
+	helperDir = "/run/lagoon"
+	// proxyAddr is where the allowlist proxy listens inside the sandbox's own network namespace
+	proxyAddr = "127.0.0.1:3128"
+)
+
+// sandboxNet is the host side of a sandbox's network plumbing. the sandbox has no
+// network of its own; a helper inside it relays through unix sockets in dir.
+type sandboxNet struct {
+	dir         string // host dir for the sockets, mounted at helperDir/net
+	self        string // lagoon binary, mounted at helperDir/lagoon
+	helperArgs  []string
+	publishArgs []string // kept apart — only one sandbox may serve a published port
+	probeArgs   []string // what other sandboxes get instead: a connect to each published port
+	listeners   []net.Listener
+}
+
+// startNet starts whatever host-side networking a sandbox needs: the allowlist
+// proxy, published ports (host → sandbox) and connects (sandbox localhost → host).
+// returns nil when the sandbox needs no helper and can be exec'd directly.
+func startNet(cfg *config.Config, publish, connect []config.Port) (*sandboxNet, error) {
+	// the "network" profile shares the host network — ports bind there directly
+	if cfg.Profile == "network" || (cfg.Profile != "allowlist" && len(publish) == 0 && len(connect) == 0) {
+		return nil, nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatic(self); err != nil {
+		return nil, err
+	}
+	// /tmp rather than the cache dir — unix socket paths are limited to 108 bytes
+	dir, err := os.MkdirTemp("", "lagoon-net-")
+	if err != nil {
+		return nil, err
+	}
+	n := &sandboxNet{dir: dir, self: self}
+	if err := n.listen(cfg, publish, connect); err != nil {
+		n.close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// checkStatic makes sure the binary can run as the helper: the sandbox only has
+// the nix closure, so a dynamically linked lagoon finds no libc there.
+func checkStatic(self string) error {
+	f, err := elf.Open(self)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", self, err)
+	}
+	defer f.Close()
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			return fmt.Errorf("%s is dynamically linked and can't run as the sandbox network helper — rebuild it with CGO_ENABLED=0", self)
+		}
+	}
+	return nil
+}
+
+// listen opens every host-side listener. published host ports are bound here,
+// so a port that's already taken fails before the sandbox starts.
+func (n *sandboxNet) listen(cfg *config.Config, publish, connect []config.Port) error {
+	if cfg.Profile == "allowlist" {
+		allow, err := netproxy.ParseAllowlist(cfg.Allow)
+		if err != nil {
+			return err
+		}
+		ln, err := net.Listen("unix", filepath.Join(n.dir, "proxy.sock"))
+		if err != nil {
+			return err
+		}
+		n.listeners = append(n.listeners, ln)
+		p := &netproxy.Proxy{Allow: allow, Denied: func(hostport string) {
+			fmt.Fprintln(os.Stderr, "\r"+warn("!")+" blocked "+hostport+" — not in allow list")
+		}}
+		go p.Serve(ln)
+		n.helperArgs = append(n.helperArgs, "--proxy", helperDir+"/net/proxy.sock")
+	}
+
+	for _, p := range publish {
+		ln, err := net.Listen("tcp", net.JoinHostPort(p.HostIP, strconv.Itoa(p.HostPort)))
+		if err != nil {
+			return fmt.Errorf("publishing port %d: %w", p.HostPort, err)
+		}
+		n.listeners = append(n.listeners, ln)
+		sock := filepath.Join(n.dir, publishSock(p.SandboxPort))
+		go netproxy.Forward(ln, func() (net.Conn, error) { return net.Dial("unix", sock) })
+		n.publishArgs = append(n.publishArgs, "--publish", strconv.Itoa(p.SandboxPort))
+
+		// a probe sandbox sees the service on its usual port, relayed via the host port
+		self, err := net.Listen("unix", filepath.Join(n.dir, connectSock(p.SandboxPort)))
+		if err != nil {
+			return err
+		}
+		n.listeners = append(n.listeners, self)
+		hostAddr := net.JoinHostPort(dialHost(p.HostIP), strconv.Itoa(p.HostPort))
+		go netproxy.Forward(self, func() (net.Conn, error) { return net.Dial("tcp", hostAddr) })
+		n.probeArgs = append(n.probeArgs, "--connect", strconv.Itoa(p.SandboxPort))
+	}
+
+	for _, p := range connect {
+		ln, err := net.Listen("unix", filepath.Join(n.dir, connectSock(p.SandboxPort)))
+		if err != nil {
+			return err
+		}
+		n.listeners = append(n.listeners, ln)
+		addr := net.JoinHostPort(dialHost(p.HostIP), strconv.Itoa(p.HostPort))
+		go netproxy.Forward(ln, func() (net.Conn, error) { return net.Dial("tcp", addr) })
+		n.helperArgs = append(n.helperArgs, "--connect", strconv.Itoa(p.SandboxPort))
+	}
+	return nil
+}
+
+// dialHost turns a listen address into one to dial — wildcards mean loopback.
+func dialHost(ip string) string {
+	if ip == "" || ip == "0.0.0.0" || ip == "::" {
+		return "127.0.0.1"
+	}
+	return ip
+}
+
+// publishSock and connectSock name the relay sockets shared by both sides.
+func publishSock(port int) string { return fmt.Sprintf("port-%d.sock", port) }
+func connectSock(port int) string { return fmt.Sprintf("connect-%d.sock", port) }
+
+// apply adds the helper, its mounts and the proxy env to opts. published ports
+// are only served when publish is set — extra sandboxes such as readiness
+// probes reuse the proxy and connects, and reach the service through its host port.
+func (n *sandboxNet) apply(opts *sandbox.Options, publish bool) {
+	opts.Binds = append(opts.Binds,
+		sandbox.Bind{Source: n.dir, Target: helperDir + "/net"},
+		sandbox.Bind{Source: n.self, Target: helperDir + "/lagoon", ReadOnly: true},
+	)
+	wrap := append([]string{helperDir + "/lagoon", "net-helper"}, n.helperArgs...)
+	if publish {
+		wrap = append(wrap, n.publishArgs...)
+	} else {
+		wrap = append(wrap, n.probeArgs...)
+	}
+	opts.Wrap = append(wrap, "--")
+	if slices.Contains(n.helperArgs, "--proxy") {
+		opts.ExtraEnvs = append(proxyEnv(), opts.ExtraEnvs...)
+	}
+}
+
+// close stops the host side and removes the socket dir.
+func (n *sandboxNet) close() {
+	for _, ln := range n.listeners {
+		ln.Close()
+	}
+	os.RemoveAll(n.dir)
+}
+
+// proxyEnv points every common proxy variable at the in-sandbox proxy.
+// both cases — curl only reads lowercase http_proxy, most other tools read either.
+func proxyEnv() []string {
+	url := "http://" + proxyAddr
+	var env []string
+	for _, k := range []string{"http_proxy", "https_proxy", "all_proxy"} {
+		env = append(env, k+"="+url, strings.ToUpper(k)+"="+url)
+	}
+	return append(env, "no_proxy=localhost,127.0.0.1", "NO_PROXY=localhost,127.0.0.1")
+}
+
+// runAttached runs a sandbox as a child instead of exec'ing into it, for features
+// that need lagoon to stay alive alongside it. returns the exit code to pass on.
+func runAttached(c *exec.Cmd) (int, error) {
+	return runAttachedUntil(c, nil, nil)
+}
+
+// runAttachedUntil is runAttached with a deadline: once expire fires, stop runs in
+// the background with a channel that's closed when c exits, and waiting goes on.
+func runAttachedUntil(c *exec.Cmd, expire <-chan time.Time, stop func(exited <-chan struct{})) (int, error) {
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// the terminal delivers Ctrl+C to the sandbox itself. catching it (rather than
+	// ignoring it, which the child would inherit) keeps lagoon alive to clean up.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	err := c.Start()
+	sandbox.CloseFiles(c)
+	if err != nil {
+		return 1, err
+	}
+	done := make(chan struct{})
+	go func() { c.Wait(); close(done) }()
+	for {
+		select {
+		case sig := <-sigs:
+			if sig == syscall.SIGTERM || sig == syscall.SIGHUP {
+				c.Process.Signal(sig)
+			}
+		case <-expire:
+			go stop(done)
+		case <-done:
+			return exitCode(c.ProcessState), nil
+		}
+	}
+}
+
+// exitCode maps a finished process to a shell-style exit status.
+func exitCode(ps *os.ProcessState) int {
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ps.ExitCode()
+}
+
+// net-helper flags: the proxy socket, and sandbox ports to publish or connect out to.
+var (
+	helperProxy   string
+	helperPublish []int
+	helperConnect []int
+)
+
+// netHelperCmd runs inside the sandbox as the parent of the user's command,
+// bridging the sandbox's private loopback to the host-side sockets.
+var netHelperCmd = &cobra.Command{
+	Use:    "net-helper [flags] -- command...",
+	Short:  "internal: network relay that runs inside the sandbox",
+	Hidden: true,
+	Args:   cobra.MinimumNArgs(1),
+	RunE:   runNetHelper,
+}
+
+func init() {
+	netHelperCmd.Flags().StringVar(&helperProxy, "proxy", "", "unix socket of the host-side proxy, served on "+proxyAddr)
+	netHelperCmd.Flags().IntSliceVar(&helperPublish, "publish", nil, "sandbox port the host can reach")
+	netHelperCmd.Flags().IntSliceVar(&helperConnect, "connect", nil, "sandbox localhost port relayed to the host")
+}
+
+func runNetHelper(cmd *cobra.Command, args []string) error {
+	sockDir := helperDir + "/net"
+	if helperProxy != "" {
+		ln, err := net.Listen("tcp", proxyAddr)
+		if err != nil {
+			return fmt.Errorf("net-helper: %w", err)
+		}
+		go netproxy.Forward(ln, func() (net.Conn, error) { return net.Dial("unix", helperProxy) })
+	}
+	for _, port := range helperPublish {
+		sock := filepath.Join(sockDir, publishSock(port))
+		os.Remove(sock) // left behind by a previous run of a restarted service
+		ln, err := net.Listen("unix", sock)
+		if err != nil {
+			return fmt.Errorf("net-helper: %w", err)
+		}
+		addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+		go netproxy.Forward(ln, func() (net.Conn, error) { return net.Dial("tcp", addr) })
+	}
+	for _, port := range helperConnect {
+		ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			return fmt.Errorf("net-helper: %w", err)
+		}
+		sock := filepath.Join(sockDir, connectSock(port))
+		go netproxy.Forward(ln, func() (net.Conn, error) { return net.Dial("unix", sock) })
+	}
+
+	c := exec.Command(args[0], args[1:]...)
+	code, err := runAttached(c)
+	if err != nil {
+		return err
+	}
+	os.Exit(code)
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
@@ -16,7 +17,20 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// sandboxPID is written to cacheDir/pid.json just before entering the sandbox.
+// every sandbox gets its own files in the project cache dir, named for the pid of
+// the lagoon that started it — bwrap keeps that pid after the exec.
+
+// pidPath is the sandbox's sandboxPID record.
+func pidPath(cacheDir string, pid int) string {
+	return filepath.Join(cacheDir, fmt.Sprintf("pid-%d.json", pid))
+}
+
+// infoPath is where bwrap reports the sandbox's child pid via --info-fd.
+func infoPath(cacheDir string, pid int) string {
+	return filepath.Join(cacheDir, fmt.Sprintf("bwrap-info-%d.json", pid))
+}
+
+// sandboxPID is written to cacheDir/pid-<pid>.json just before entering the sandbox.
 type sandboxPID struct {
 	PID      int      `json:"pid"`
 	Project  string   `json:"project"`
@@ -24,8 +38,10 @@ type sandboxPID struct {
 	Started  string   `json:"started"`
 }
 
-// writePIDFile records the current process's PID and project metadata.
+// writePIDFile records the current process's PID and project metadata, and clears
+// out the files of sandboxes that have exited — one exec'd into bwrap can't.
 func writePIDFile(cacheDir, project string, packages []string) {
+	liveSandboxes(cacheDir)
 	info := sandboxPID{
 		PID:      os.Getpid(),
 		Project:  project,
@@ -33,7 +49,38 @@ func writePIDFile(cacheDir, project string, packages []string) {
 		Started:  time.Now().Format(time.RFC3339),
 	}
 	b, _ := json.Marshal(info)
-	_ = os.WriteFile(filepath.Join(cacheDir, "pid.json"), b, 0644)
+	_ = os.WriteFile(pidPath(cacheDir, info.PID), b, 0644)
+}
+
+// removePIDFile removes the current process's sandbox files once its sandbox is gone.
+func removePIDFile(cacheDir string) {
+	os.Remove(pidPath(cacheDir, os.Getpid()))
+	os.Remove(infoPath(cacheDir, os.Getpid()))
+}
+
+// liveSandboxes returns the sandboxes still running from cacheDir, oldest first,
+// removing the files of those that have exited.
+func liveSandboxes(cacheDir string) []sandboxPID {
+	files, _ := filepath.Glob(filepath.Join(cacheDir, "pid-*.json"))
+	var live []sandboxPID
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var info sandboxPID
+		if json.Unmarshal(b, &info) != nil || f != pidPath(cacheDir, info.PID) {
+			continue
+		}
+		if !isProcessAlive(info.PID) {
+			os.Remove(f)
+			os.Remove(infoPath(cacheDir, info.PID))
+			continue
+		}
+		live = append(live, info)
+	}
+	slices.SortFunc(live, func(a, b sandboxPID) int { return strings.Compare(a.Started, b.Started) })
+	return live
 }
 
 var psCmd = &cobra.Command{
@@ -52,14 +99,17 @@ func runPs(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
-		cacheDir := projectCacheDir(absPath)
-		shellNixPath := filepath.Join(cacheDir, "shell.nix")
 
-		fmt.Println("  packages: " + strings.Join(cfg.Packages, " "))
+		if cfg.Flake != "" {
+			fmt.Println("  flake:    " + cfg.Flake)
+		} else {
+			fmt.Println("  packages: " + strings.Join(slices.Concat(cfg.PackageNames(), langNames(cfg)), " "))
+		}
 		fmt.Println("  profile:  " + cfg.Profile)
 
-		sum, _ := nix.GenerateShellNix(cfg, shellNixPath)
-		if _, hit := nix.LoadCache(cacheDir, sum); hit {
+		if src, err := nix.Prepare(cfg, envBase(), absPath); err != nil {
+			fmt.Println(warn("!") + " " + err.Error())
+		} else if _, hit := nix.LoadCache(src.Dir, src.Sum); hit {
 			fmt.Println(ok("✓") + " cached — next 'lagoon shell' starts instantly")
 		} else {
 			fmt.Println(warn("!") + " not cached — run 'lagoon shell' to build")
@@ -75,30 +125,17 @@ func runPs(cmd *cobra.Command, args []string) error {
 
 	lagoonCache := lagoonCacheBase()
 
-	entries, err := filepath.Glob(filepath.Join(lagoonCache, "*/pid.json"))
-	if err != nil || len(entries) == 0 {
-		fmt.Println("  no sandboxes running")
-		return nil
-	}
+	dirs, _ := filepath.Glob(filepath.Join(lagoonCache, "*"))
 
 	running := 0
-	for _, pidFile := range entries {
-		b, err := os.ReadFile(pidFile)
-		if err != nil {
-			continue
-		}
-		var info sandboxPID
-		if err := json.Unmarshal(b, &info); err != nil {
-			continue
-		}
-		if !isProcessAlive(info.PID) {
-			continue
+	for _, dir := range dirs {
+		for _, info := range liveSandboxes(dir) {
+			mem := readProcessMem(info.PID)
+			pkgs := strings.Join(info.Packages, " ")
+			fmt.Printf("  %s  pid %-6d  %-8s  %s\n", ok("●"), info.PID, mem, pkgs)
+			fmt.Printf("     %s\n", info.Project)
+			running++
 		}
-		mem := readProcessMem(info.PID)
-		pkgs := strings.Join(info.Packages, " ")
-		fmt.Printf("  %s  pid %-6d  %-8s  %s\n", ok("●"), info.PID, mem, pkgs)
-		fmt.Printf("     %s\n", info.Project)
-		running++
 	}
 
 	if running == 0 {
@@ -106,9 +143,35 @@ func runPs(cmd *cobra.Command, args []string) error {
 	} else {
 		fmt.Printf("\n  %d sandbox(es) running\n", running)
 	}
+
+	printDetached(lagoonCache)
 	return nil
 }
 
+// printDetached lists services started by 'lagoon up -d' whose supervisor is still alive.
+func printDetached(lagoonCache string) {
+	states, _ := filepath.Glob(filepath.Join(lagoonCache, "*", upStateFile))
+	for _, path := range states {
+		st, err := readUpState(filepath.Dir(path))
+		if err != nil || !st.running() {
+			continue
+		}
+		fmt.Printf("\n  services  %s  (supervisor pid %d)\n", st.Project, st.PID)
+		for _, svc := range st.Services {
+			mark := warn("○")
+			mem := ""
+			if svc.alive() {
+				mark = ok("●")
+				mem = readProcessMem(svc.PID)
+			}
+			if svc.State == "failed" {
+				mark = fail("●")
+			}
+			fmt.Printf("  %s  %-12s  %-10s  pid %-6d  %s\n", mark, svc.Name, svc.State, svc.PID, mem)
+		}
+	}
+}
+
 // isProcessAlive sends signal 0 to check if a process exists.
 func isProcessAlive(pid int) bool {
 	return syscall.Kill(pid, 0) == nil
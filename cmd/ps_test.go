@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveSandboxes(t *testing.T) {
+	// a pid that has certainly exited
+	done := exec.Command("true")
+	require.NoError(t, done.Run())
+	dead := done.Process.Pid
+
+	other := exec.Command("sleep", "60")
+	require.NoError(t, other.Start())
+	t.Cleanup(func() { other.Process.Kill(); other.Wait() })
+	running := other.Process.Pid
+
+	dir := t.TempDir()
+	write := func(path string, info sandboxPID) {
+		b, err := json.Marshal(info)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, b, 0644))
+	}
+	self := os.Getpid()
+	write(pidPath(dir, self), sandboxPID{PID: self, Project: "/p", Started: "2026-01-02T03:04:06Z"})
+	write(pidPath(dir, running), sandboxPID{PID: running, Project: "/p", Started: "2026-01-02T03:04:05Z"})
+	write(pidPath(dir, dead), sandboxPID{PID: dead, Project: "/p"})
+	require.NoError(t, os.WriteFile(infoPath(dir, dead), []byte(`{"child-pid": 2}`), 0644))
+	// named for one pid, recording another — not trusted
+	write(pidPath(dir, 99999999), sandboxPID{PID: self})
+
+	live := liveSandboxes(dir)
+	require.Len(t, live, 2)
+	assert.Equal(t, running, live[0].PID, "oldest first")
+	assert.Equal(t, self, live[1].PID)
+
+	assert.NoFileExists(t, pidPath(dir, dead), "an exited sandbox's files are removed")
+	assert.NoFileExists(t, infoPath(dir, dead))
+	assert.FileExists(t, pidPath(dir, self))
+	assert.True(t, projectRunning(dir))
+
+	removePIDFile(dir)
+	assert.NoFileExists(t, pidPath(dir, self))
+	os.Remove(pidPath(dir, running))
+	assert.False(t, projectRunning(dir))
+}
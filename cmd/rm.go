@@ -27,10 +27,29 @@ func runRm(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	sum := projectEnv(dir)
 	if err := os.RemoveAll(dir); err != nil {
 		return fmt.Errorf("removing cache: %w", err)
 	}
-
 	fmt.Println(ok("✓") + " removed cache: " + dir)
+
+	// the environment itself is shared — keep it while another project links to it
+	if sum == "" {
+		return nil
+	}
+	others := 0
+	for _, u := range envUses() {
+		if u.Sum == sum {
+			others++
+		}
+	}
+	if others > 0 {
+		fmt.Printf("  environment %s kept — %d other project(s) use it\n", sum, others)
+		return nil
+	}
+	if err := os.RemoveAll(filepath.Join(envBase(), sum)); err != nil {
+		return fmt.Errorf("removing environment: %w", err)
+	}
+	fmt.Println(ok("✓") + " removed environment " + sum)
 	return nil
 }
@@ -37,13 +37,23 @@ func init() {
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(shellCmd)
 	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(execCmd)
 	rootCmd.AddCommand(upCmd)
+	rootCmd.AddCommand(downCmd)
+	rootCmd.AddCommand(logsCmd)
 	rootCmd.AddCommand(psCmd)
 	rootCmd.AddCommand(rmCmd)
+	rootCmd.AddCommand(gcCmd)
+	rootCmd.AddCommand(volumeCmd)
+	rootCmd.AddCommand(cacheCmd)
 	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(updateCmd)
+	rootCmd.AddCommand(lockCmd)
 	rootCmd.AddCommand(saveCmd)
 	rootCmd.AddCommand(loadCmd)
+	rootCmd.AddCommand(keysCmd)
 	rootCmd.AddCommand(dockerCmd)
 	rootCmd.AddCommand(watchCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(netHelperCmd)
 }
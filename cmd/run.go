@@ -1,16 +1,28 @@
 package cmd
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+var timeoutFlag time.Duration
+
 var runCmd = &cobra.Command{
 	Use:   "run [command]",
 	Short: "run a one-off command in the sandbox (like 'shell --cmd')",
+	Long: `lagoon run python3 script.py
+lagoon run --timeout 5m ./grade.sh
+
+With --timeout, every process in the sandbox gets SIGTERM when time runs out
+and SIGKILL 5s later; lagoon then exits with status 124.`,
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if timeoutFlag < 0 {
+			return fmt.Errorf("--timeout must be positive")
+		}
 		cmdFlag = shellQuoteArgs(args)
 		return runShell(cmd, nil)
 	},
@@ -27,5 +39,8 @@ func shellQuoteArgs(args []string) string {
 }
 
 func init() {
-	runCmd.Flags().StringVarP(&memFlag, "memory", "m", "", "limit sandbox memory via systemd-run (e.g. 512m, 1g)")
+	addLimitFlags(runCmd)
+	runCmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "stop the sandbox after this long (e.g. 30s, 5m) and exit 124")
+	runCmd.Flags().StringArray("mount", nil, "bind a host path into the sandbox (source:target[:ro|rw], default ro)")
+	addLockFlags(runCmd)
 }
@@ -3,9 +3,11 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/imraghavojha/lagoon/internal/bundle"
 	"github.com/imraghavojha/lagoon/internal/config"
 	"github.com/imraghavojha/lagoon/internal/nix"
 	"github.com/spf13/cobra"
@@ -13,37 +15,75 @@ import (
 
 var saveCmd = &cobra.Command{
 	Use:   "save",
-	Short: "export the environment to a .nar file for offline use",
-	Long: `lagoon save > myenv.nar
+	Short: "export the environment to a bundle for offline use",
+	Long: `lagoon save > myenv.bundle
+lagoon save --compress zstd > myenv.bundle.zst
+lagoon save --since last.bundle > update.bundle
+lagoon save --exclude-from target-paths.txt > update.bundle
+lagoon save --sign build-1 > myenv.bundle
+lagoon save --to-cache /srv/nix-cache --compress zstd --sign build-1
 
-Snapshots every nix store path the environment needs. The resulting file can
-be transferred to an air-gapped machine and loaded with 'lagoon load'.
-Uses 'nix-store --export' under the hood — no registry, no internet required
-after export.`,
+Snapshots every nix store path the environment needs into a single file, with
+a manifest carrying the lagoon.toml, the resolved environment and the sha256 of
+every path. The file can be transferred to an air-gapped machine and loaded
+with 'lagoon load', which verifies it and makes the first shell instant —
+no registry, no internet required after export. 'lagoon load' detects
+compression by itself.
+
+--since and --exclude-from leave out store paths the target already has: every
+path in an earlier bundle, or every path listed in a file (one per line, e.g.
+from 'ls -d /nix/store/*' on the target). The bundle records them as
+prerequisites, and 'lagoon load' refuses it unless they are all present.
+
+--sign signs the manifest with a key from 'lagoon keys generate' or a nix
+secret key file; it lists every path's hash, so the signature covers it all.
+
+--to-cache writes a nix binary cache directory instead of a bundle:
+nix-cache-info, one .narinfo per path and the NARs under nar/. Serve it from
+any static file server or share, and list it under substituters in
+lagoon.toml. Paths already in the cache are skipped, and --sign signs each
+narinfo the way nix-store expects.`,
 	RunE: runSave,
 }
 
+var (
+	saveCompress    string
+	saveSince       []string
+	saveExcludeFrom []string
+	saveSign        string
+	saveToCache     string
+)
+
+func init() {
+	saveCmd.Flags().StringVar(&saveCompress, "compress", "none", "compress the bundle: zstd, gzip or none")
+	saveCmd.Flags().StringArrayVar(&saveSince, "since", nil, "leave out paths already in this bundle (repeatable)")
+	saveCmd.Flags().StringArrayVar(&saveExcludeFrom, "exclude-from", nil, "leave out store paths listed in this file (repeatable)")
+	saveCmd.Flags().StringVar(&saveSign, "sign", "", "sign the bundle or cache with this key (a name from 'lagoon keys list' or a key file)")
+	saveCmd.Flags().StringVar(&saveToCache, "to-cache", "", "write a nix binary cache into this directory instead of a bundle to stdout")
+}
+
 func runSave(cmd *cobra.Command, args []string) error {
 	// refuse to dump binary NAR data to a terminal — caller must redirect
-	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
-		return fmt.Errorf("stdout is a terminal — redirect to a file: lagoon save > myenv.nar")
+	if info, err := os.Stdout.Stat(); saveToCache == "" && err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return fmt.Errorf("stdout is a terminal — redirect to a file: lagoon save > myenv.bundle")
 	}
 
 	cfg, err := config.Read(config.Filename)
 	if err != nil {
 		return fmt.Errorf("no lagoon.toml found — run 'lagoon init' first")
 	}
+	raw, err := os.ReadFile(config.Filename)
+	if err != nil {
+		return err
+	}
 
 	absPath, _ := filepath.Abs(".")
-	cacheDir := projectCacheDir(absPath)
-	shellNixPath := filepath.Join(cacheDir, "shell.nix")
-
-	sum, err := nix.GenerateShellNix(cfg, shellNixPath)
+	src, err := nix.Prepare(cfg, envBase(), absPath)
 	if err != nil {
 		return err
 	}
 
-	resolved, hit := nix.LoadCache(cacheDir, sum)
+	resolved, hit := nix.LoadCache(src.Dir, src.Sum)
 	if !hit {
 		return fmt.Errorf("no cached environment — run 'lagoon shell' first to build it")
 	}
@@ -52,11 +92,137 @@ func runSave(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("nix-store -qR: %w", err)
 	}
+	var key *nix.SecretKey
+	if saveSign != "" {
+		if key, err = readSecretKey(saveSign); err != nil {
+			return err
+		}
+	}
 
-	fmt.Fprintln(os.Stderr, ok("→")+" exporting "+fmt.Sprint(len(paths))+" store paths…")
+	have, err := targetPaths()
+	if err != nil {
+		return err
+	}
+	var missing, prereqs []string
+	for _, p := range paths {
+		if have[p] {
+			prereqs = append(prereqs, p)
+		} else {
+			missing = append(missing, p)
+		}
+	}
+	var infos []nix.PathInfo
+	if len(missing) > 0 {
+		if infos, err = nix.QueryPathInfo(missing); err != nil {
+			return err
+		}
+	}
 
-	exp := exec.Command("nix-store", append([]string{"--export"}, paths...)...)
-	exp.Stdout = os.Stdout
-	exp.Stderr = os.Stderr
-	return exp.Run()
+	var total int64
+	for _, p := range infos {
+		total += p.NarSize
+	}
+	if saveToCache != "" {
+		return saveBinaryCache(infos, total, key)
+	}
+
+	out, err := bundle.Compress(os.Stdout, saveCompress)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ok("→")+" exporting "+fmt.Sprint(len(infos))+" store paths ("+humanBytes(total)+" uncompressed)…")
+	if len(prereqs) > 0 {
+		fmt.Fprintf(os.Stderr, "  %d paths already on the target are left out\n", len(prereqs))
+	}
+
+	m := &bundle.Manifest{
+		Created:       time.Now().UTC().Truncate(time.Second),
+		Config:        string(raw),
+		Sum:           src.Sum,
+		Env:           *resolved,
+		Paths:         infos,
+		Prerequisites: prereqs,
+	}
+	var count byteCount
+	err = withTransferProgress("saving ", total, &count, func() error {
+		if err := bundle.Write(out, m, key, &count); err != nil {
+			return err
+		}
+		return out.Close()
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ok("✓")+" closure sha256 "+m.ClosureSHA256)
+	if key != nil {
+		fmt.Fprintln(os.Stderr, ok("✓")+" signed with "+key.Name)
+	}
+	return nil
+}
+
+// saveBinaryCache adds infos to the binary cache at --to-cache.
+func saveBinaryCache(infos []nix.PathInfo, total int64, key *nix.SecretKey) error {
+	if saveCompress == "gzip" {
+		return fmt.Errorf("binary caches support --compress zstd or none")
+	}
+	if err := nix.InitBinaryCache(saveToCache); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, ok("→")+" adding "+fmt.Sprint(len(infos))+" store paths to "+saveToCache+" ("+humanBytes(total)+" uncompressed)…")
+	var count byteCount
+	added := 0
+	err := withTransferProgress("caching", total, &count, func() error {
+		for _, info := range infos {
+			isNew, err := nix.AddToBinaryCache(saveToCache, info, saveCompress, key, &count)
+			if err != nil {
+				return fmt.Errorf("%s: %w", info.Path, err)
+			}
+			if isNew {
+				added++
+			} else {
+				count.n.Add(info.NarSize)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s %d paths added, %d already cached\n", ok("✓"), added, len(infos)-added)
+	if key != nil {
+		fmt.Fprintln(os.Stderr, ok("✓")+" signed with "+key.Name+" — add "+key.Public().String()+" to trusted_keys")
+	}
+	return nil
+}
+
+// targetPaths collects the store paths --since and --exclude-from say the target has.
+func targetPaths() (map[string]bool, error) {
+	have := map[string]bool{}
+	for _, b := range saveSince {
+		m, err := bundle.ReadManifest(b)
+		if err != nil {
+			return nil, fmt.Errorf("--since: %w", err)
+		}
+		for _, p := range m.StorePaths() {
+			have[p] = true
+		}
+	}
+	for _, f := range saveExcludeFrom {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("--exclude-from: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			// bare names too, e.g. from ls /nix/store
+			if !strings.HasPrefix(line, "/") {
+				line = "/nix/store/" + line
+			}
+			have[line] = true
+		}
+	}
+	return have, nil
 }
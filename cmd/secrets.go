@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/sandbox"
+)
+
+// sandboxSecrets reads every [secrets] entry from its source on the host, in name order.
+func sandboxSecrets(cfg *config.Config, projectPath string) ([]sandbox.Secret, error) {
+	names := make([]string, 0, len(cfg.Secrets))
+	for name := range cfg.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var secrets []sandbox.Secret
+	for _, name := range names {
+		data, err := readSecret(cfg.Secrets[name], projectPath)
+		if err != nil {
+			return nil, fmt.Errorf("secret %q: %w", name, err)
+		}
+		secrets = append(secrets, sandbox.Secret{Name: name, Data: data})
+	}
+	return secrets, nil
+}
+
+// readSecret fetches one value. command output loses its trailing newline, like $(...).
+func readSecret(s config.Secret, projectPath string) ([]byte, error) {
+	switch {
+	case s.Plain != "":
+		return nil, fmt.Errorf("written in plaintext in lagoon.toml — use file, command, env or prompt instead")
+	case s.File != "":
+		path, err := secretPath(s.File, projectPath)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(path)
+	case s.Command != "":
+		// stdin and stderr stay on the terminal, for gpg pinentry and the like
+		c := exec.Command("sh", "-c", s.Command)
+		c.Dir = projectPath
+		c.Stdin, c.Stderr = os.Stdin, os.Stderr
+		out, err := c.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Command, err)
+		}
+		return bytes.TrimSuffix(out, []byte("\n")), nil
+	case s.Env != "":
+		v, found := os.LookupEnv(s.Env)
+		if !found {
+			return nil, fmt.Errorf("$%s is not set", s.Env)
+		}
+		return []byte(v), nil
+	}
+	var value string
+	if err := huh.NewInput().
+		Title(s.Prompt).
+		EchoMode(huh.EchoModePassword).
+		Value(&value).
+		Run(); err != nil {
+		return nil, err
+	}
+	return []byte(value), nil
+}
+
+// secretPath resolves a secret file: ~/ is the host home, relative paths the project.
+func secretPath(p, projectPath string) (string, error) {
+	if strings.HasPrefix(p, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, p[2:]), nil
+	}
+	if !filepath.IsAbs(p) {
+		return filepath.Join(projectPath, p), nil
+	}
+	return p, nil
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSecret(t *testing.T) {
+	project := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(project, "token"), []byte("from-file\n"), 0600))
+	t.Setenv("LAGOON_TEST_TOKEN", "from-env")
+	tests := []struct {
+		name    string
+		secret  config.Secret
+		want    string
+		wantErr string
+	}{
+		{name: "file kept as is", secret: config.Secret{File: "token"}, want: "from-file\n"},
+		{name: "command loses its newline", secret: config.Secret{Command: "echo from-command"}, want: "from-command"},
+		{name: "command runs in the project", secret: config.Secret{Command: "cat token"}, want: "from-file"},
+		{name: "env", secret: config.Secret{Env: "LAGOON_TEST_TOKEN"}, want: "from-env"},
+		{name: "unset env", secret: config.Secret{Env: "LAGOON_TEST_UNSET"}, wantErr: "$LAGOON_TEST_UNSET is not set"},
+		{name: "failing command", secret: config.Secret{Command: "exit 3"}, wantErr: "exit status 3"},
+		{name: "plaintext", secret: config.Secret{Plain: "hunter2"}, wantErr: "written in plaintext"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readSecret(tt.secret, project)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
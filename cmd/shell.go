@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/charmbracelet/huh"
 	"github.com/imraghavojha/lagoon/internal/config"
-	"github.com/imraghavojha/lagoon/internal/nix"
 	"github.com/imraghavojha/lagoon/internal/preflight"
 	"github.com/imraghavojha/lagoon/internal/sandbox"
 	"github.com/spf13/cobra"
@@ -19,7 +20,6 @@ import (
 var (
 	cmdFlag  string
 	envFlags []string
-	memFlag  string
 )
 
 var shellCmd = &cobra.Command{
@@ -31,7 +31,9 @@ var shellCmd = &cobra.Command{
 func init() {
 	shellCmd.Flags().StringVar(&cmdFlag, "cmd", "", "run a one-off command instead of an interactive shell")
 	shellCmd.Flags().StringArrayVarP(&envFlags, "env", "e", nil, "set env var in sandbox (KEY=VALUE)")
-	shellCmd.Flags().StringVarP(&memFlag, "memory", "m", "", "limit sandbox memory via systemd-run (e.g. 512m, 1g)")
+	addLimitFlags(shellCmd)
+	shellCmd.Flags().StringArray("mount", nil, "bind a host path into the sandbox (source:target[:ro|rw], default ro)")
+	addLockFlags(shellCmd)
 }
 
 func runShell(cmd *cobra.Command, args []string) error {
@@ -69,68 +71,127 @@ func runShell(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("getting working directory: %w", err)
 	}
 	cacheDir := projectCacheDir(absPath)
-	shellNixPath := filepath.Join(cacheDir, "shell.nix")
 
-	// write shell.nix (skips write if content unchanged)
-	sum, err := nix.GenerateShellNix(cfg, shellNixPath)
+	// volumes and host mounts — validated before the slow resolve so typos fail fast
+	mounts, _ := cmd.Flags().GetStringArray("mount")
+	binds, err := sandboxBinds(cfg, absPath, mounts)
 	if err != nil {
-		return fmt.Errorf("generating shell.nix: %w", err)
+		return err
 	}
-
-	// warm start: skip nix-shell entirely if we have a matching cached env
-	resolved, hit := nix.LoadCache(cacheDir, sum)
-
-	// nix-collect-garbage can wipe store paths even when the cache file is valid
-	if hit {
-		if _, err := os.Stat(resolved.BashPath); err != nil {
-			hit = false
-		}
+	ports, err := config.ParsePorts(cfg.Ports)
+	if err != nil {
+		return err
+	}
+	limits, err := sandboxLimits(cfg)
+	if err != nil {
+		return err
+	}
+	envs, err := sandboxEnvs(cfg, absPath, envFlags)
+	if err != nil {
+		return err
+	}
+	secrets, err := sandboxSecrets(cfg, absPath)
+	if err != nil {
+		return err
 	}
 
-	if !hit {
-		// arm warning only matters on cold starts — warm starts are instant
-		if runtime.GOARCH == "arm64" {
-			fmt.Println(warn("!") + " arm: first run may take 10-60 min to compile packages")
-			fmt.Println("  this only happens once. subsequent runs start in under a second.")
-		}
+	resolved, sum, err := resolveEnv(cfg, absPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
 
-		// run nix-shell with a bubbletea spinner showing live progress
-		env, err := resolveWithProgress(shellNixPath)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
-		}
-		resolved = env
-		_ = nix.SaveCache(cacheDir, resolved, sum)
-	} else {
-		fmt.Println(ok("✓") + " environment ready")
+	// same lagoon.toml must mean same store paths — lagoon.lock is the proof
+	if err := checkLock(cfg, resolved, sum, ignoreLockFlag, updateLockFlag); err != nil {
+		fmt.Fprintln(os.Stderr, fail("✗")+" "+err.Error())
+		os.Exit(1)
 	}
 
-	// always register gc roots so nix-collect-garbage won't wipe the env on next warm start
-	nix.CreateGCRoots(cacheDir, resolved)
+	// bind published ports now so a busy port fails before the banner
+	netw, err := startNet(cfg, ports, nil)
+	if err != nil {
+		return fmt.Errorf("starting network helper: %w", err)
+	}
 
 	// banner so users know they're inside the sandbox
 	netStr := "off"
-	if cfg.Profile == "network" {
+	switch cfg.Profile {
+	case "network":
 		netStr = "on"
+	case "allowlist":
+		netStr = fmt.Sprintf("allowlist (%d)", len(cfg.Allow))
 	}
-	memStr := ""
-	if memFlag != "" {
-		memStr = " │ mem: " + strings.ToUpper(memFlag)
+	if len(ports) > 0 && cfg.Profile != "network" {
+		published := make([]string, len(ports))
+		for i, p := range ports {
+			published[i] = fmt.Sprintf("%d→%d", p.HostPort, p.SandboxPort)
+		}
+		netStr += " │ ports: " + strings.Join(published, " ")
+	}
+	pkgStr := strings.Join(slices.Concat(cfg.PackageNames(), langNames(cfg)), "  ")
+	if cfg.Flake != "" {
+		pkgStr = "flake " + cfg.Flake
 	}
 	fmt.Printf("\n%s │ %s │ /workspace │ network: %s%s\n",
-		ok("lagoon"), strings.Join(cfg.Packages, "  "), netStr, memStr)
+		ok("lagoon"), pkgStr, netStr, limitsBanner(limits))
 	// one-off commands don't have an interactive shell to exit from
 	if cmdFlag == "" {
 		fmt.Println("  type 'exit' to return to host shell")
 	}
 	fmt.Println()
 
-	// record pid so 'lagoon stats' can find this sandbox (same pid after syscall.Exec)
-	writePIDFile(cacheDir, absPath, cfg.Packages)
+	// record pid so 'lagoon ps' and 'lagoon exec' can find this sandbox (same pid after syscall.Exec)
+	writePIDFile(cacheDir, absPath, cfg.PackageNames())
+
+	opts := sandbox.Options{
+		Cmd:       cmdFlag,
+		Limits:    limits,
+		ExtraEnvs: envs,
+		InfoFile:  infoPath(cacheDir, os.Getpid()),
+		Binds:     binds,
+		Secrets:   secrets,
+	}
+
+	// the proxy, port relays and timeout live in this process, so stay around as the sandbox's parent
+	if netw != nil || timeoutFlag > 0 {
+		if netw != nil {
+			netw.apply(&opts, true)
+		}
+		c, err := sandbox.Build(cfg, resolved, absPath, opts)
+		if err != nil {
+			if netw != nil {
+				netw.close()
+			}
+			removePIDFile(cacheDir)
+			return err
+		}
+		var expire <-chan time.Time
+		if timeoutFlag > 0 {
+			expire = time.After(timeoutFlag)
+		}
+		var timedOut atomic.Bool
+		code, err := runAttachedUntil(c, expire, func(exited <-chan struct{}) {
+			timedOut.Store(true)
+			stopSandbox(c, opts.InfoFile, exited)
+		})
+		if netw != nil {
+			netw.close()
+		}
+		removePIDFile(cacheDir)
+		if err != nil {
+			return err
+		}
+		if timedOut.Load() {
+			fmt.Fprintf(os.Stderr, "%s timed out after %s\n", fail("✗"), timeoutFlag)
+			code = timeoutExit
+		}
+		os.Exit(code)
+	}
 
-	// replace this process with bwrap — no cleanup needed on exit
-	return sandbox.Enter(cfg, resolved, absPath, cmdFlag, memFlag, envFlags)
+	// replace this process with bwrap — its files go once another lagoon finds it gone
+	err = sandbox.Enter(cfg, resolved, absPath, opts)
+	removePIDFile(cacheDir) // bwrap never started
+	return err
 }
 
 // projectCacheDir returns the lagoon cache dir for a specific project path.
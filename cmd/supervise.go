@@ -0,0 +1,404 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/nix"
+	"github.com/imraghavojha/lagoon/internal/sandbox"
+)
+
+const (
+	// restart backoff doubles from minBackoff up to maxBackoff, and resets once
+	// a service has stayed up for stableAfter
+	minBackoff  = time.Second
+	maxBackoff  = 30 * time.Second
+	stableAfter = 30 * time.Second
+
+	probeInterval = 500 * time.Millisecond
+	stopGrace     = 500 * time.Millisecond
+)
+
+var probeClient = &http.Client{Timeout: 2 * time.Second}
+
+// supervisor runs the [up] services: dependency order, readiness probes and restarts.
+type supervisor struct {
+	cfg      *config.Config
+	env      *nix.ResolvedEnv
+	project  string
+	base     sandbox.Options // shared by every service; Cmd, Dir and service env are added per service
+	svcs     []*service
+	byName   map[string]*service
+	stopping chan struct{} // closed by stop — nothing new starts after that
+	wg       sync.WaitGroup
+
+	// onState, if set, is told about every lifecycle change — detached mode records them
+	onState func(name, state string, pid int)
+}
+
+// service is the runtime state of one [up] entry.
+type service struct {
+	name  string
+	spec  config.Service
+	label string // colored name for status lines
+	pw    *io.PipeWriter
+
+	cfg   *config.Config // the service's own copy — its network profile may differ
+	net   *sandboxNet    // nil when the service shares the host network
+	ports []config.Port  // published ports, for probes run from the host
+
+	ready     chan struct{} // closed once the probe passes or gives up
+	readyOK   bool          // written before ready is closed
+	readyOnce sync.Once
+
+	mu   sync.Mutex
+	proc *exec.Cmd     // most recent process
+	done chan struct{} // closed when proc exits
+}
+
+func newSupervisor(cfg *config.Config, env *nix.ResolvedEnv, project string, base sandbox.Options) *supervisor {
+	return &supervisor{
+		cfg:      cfg,
+		env:      env,
+		project:  project,
+		base:     base,
+		byName:   map[string]*service{},
+		stopping: make(chan struct{}),
+	}
+}
+
+// add registers a service. its output goes to out, each line prefixed.
+// services must be added in dependency order.
+func (sup *supervisor) add(name string, spec config.Service, prefix, label string, out io.Writer) *service {
+	pr, pw := io.Pipe()
+	go prefixLines(out, prefix, pr)
+	s := &service{name: name, spec: spec, label: label, pw: pw, cfg: sup.cfg, ready: make(chan struct{})}
+	sup.svcs = append(sup.svcs, s)
+	sup.byName[name] = s
+	return s
+}
+
+// start launches every service in the background. each one waits for its
+// dependencies to become ready before its first start.
+func (sup *supervisor) start() {
+	for _, s := range sup.svcs {
+		sup.wg.Add(1)
+		go sup.run(s)
+	}
+}
+
+// stop sends SIGTERM to every running service, kills what's still up after
+// stopGrace, and waits for all of them to exit.
+func (sup *supervisor) stop() {
+	close(sup.stopping)
+	var wg sync.WaitGroup
+	for _, s := range sup.svcs {
+		wg.Add(1)
+		go func(s *service) {
+			defer wg.Done()
+			s.terminate()
+		}(s)
+	}
+	wg.Wait()
+	sup.wg.Wait()
+	sup.closeNets()
+	for _, s := range sup.svcs {
+		s.pw.Close()
+		sup.setState(s, "stopped", 0)
+	}
+}
+
+// setState reports a lifecycle change to onState, if anyone is listening.
+func (sup *supervisor) setState(s *service, state string, pid int) {
+	if sup.onState != nil {
+		sup.onState(s.name, state, pid)
+	}
+}
+
+func (sup *supervisor) stopped() bool {
+	select {
+	case <-sup.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// run is the lifecycle of one service: wait for deps, start, restart per policy.
+func (sup *supervisor) run(s *service) {
+	defer sup.wg.Done()
+
+	for _, dep := range s.spec.DependsOn {
+		d := sup.byName[dep]
+		select {
+		case <-d.ready:
+		case <-sup.stopping:
+			return
+		}
+		if !d.readyOK {
+			fmt.Fprintln(os.Stderr, warn("!")+" not starting "+s.name+": "+dep+" never became ready")
+			sup.setState(s, "skipped", 0)
+			s.markReady(false) // so dependents skip too
+			return
+		}
+	}
+
+	backoff := minBackoff
+	for {
+		started := time.Now()
+		c, done, err := sup.startProc(s)
+		if sup.stopped() {
+			return
+		}
+		failed := true
+		if err != nil {
+			fmt.Fprintln(os.Stderr, warn("!")+" starting "+s.name+": "+err.Error())
+		} else {
+			fmt.Println(ok("→") + " " + s.label)
+			sup.setState(s, "running", c.Process.Pid)
+			if !s.isReady() {
+				go sup.probe(s, done)
+			}
+			<-done
+			if sup.stopped() {
+				return
+			}
+			failed = !c.ProcessState.Success()
+			state := "exited"
+			if failed {
+				state = "failed"
+			}
+			sup.setState(s, state, 0)
+			if failed {
+				fmt.Fprintln(os.Stderr, warn("!")+" service "+s.name+" exited ("+c.ProcessState.String()+")")
+			} else {
+				fmt.Fprintln(os.Stderr, warn("!")+" service "+s.name+" exited")
+			}
+		}
+
+		if !shouldRestart(s.spec.Restart, failed) {
+			s.markReady(false) // no-op if it already became ready
+			return
+		}
+		if time.Since(started) > stableAfter {
+			backoff = minBackoff
+		}
+		fmt.Fprintf(os.Stderr, "%s restarting %s in %s\n", warn("↻"), s.name, backoff)
+		sup.setState(s, "restarting", 0)
+		select {
+		case <-time.After(backoff):
+		case <-sup.stopping:
+			return
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// startProc starts a fresh process for s. the stopping check happens under the
+// lock so stop never misses a process started concurrently.
+func (sup *supervisor) startProc(s *service) (*exec.Cmd, chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sup.stopped() {
+		return nil, nil, nil
+	}
+	opts := s.opts(sup.base, s.spec.Cmd)
+	if s.net != nil {
+		s.net.apply(&opts, true)
+	}
+	c, err := sandbox.Build(s.cfg, sup.env, sup.project, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.Stdout = s.pw
+	c.Stderr = s.pw
+	err = c.Start()
+	sandbox.CloseFiles(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	done := make(chan struct{})
+	go func() { c.Wait(); close(done) }()
+	s.proc, s.done = c, done
+	return c, done, nil
+}
+
+// terminate stops the current process: SIGTERM, then SIGKILL after stopGrace.
+func (s *service) terminate() {
+	s.mu.Lock()
+	c, done := s.proc, s.done
+	s.mu.Unlock()
+	if c == nil || c.Process == nil {
+		return
+	}
+	c.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(stopGrace):
+		c.Process.Kill()
+		<-done
+	}
+}
+
+// opts returns the sandbox options for running cmd as part of this service.
+// service env comes after base's, so it wins on conflicts.
+func (s *service) opts(base sandbox.Options, cmd string) sandbox.Options {
+	envs := make([]string, 0, len(s.spec.Env))
+	for k, v := range s.spec.Env {
+		envs = append(envs, k+"="+v)
+	}
+	sort.Strings(envs)
+	opts := base
+	opts.Cmd = cmd
+	opts.ExtraEnvs = append(append([]string(nil), base.ExtraEnvs...), envs...)
+	opts.Dir = s.spec.Cwd
+	return opts
+}
+
+// markReady records the probe's verdict and releases dependents. only the first call counts.
+func (s *service) markReady(ok bool) {
+	s.readyOnce.Do(func() {
+		s.readyOK = ok
+		close(s.ready)
+	})
+}
+
+// isReady reports whether the probe has given its verdict.
+func (s *service) isReady() bool {
+	select {
+	case <-s.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// probe polls the readiness check until it passes, times out, or we stop.
+// it also ends when the process it's probing exits; run starts a fresh probe
+// for a restarted process. services without a check are ready as soon as they've started.
+func (sup *supervisor) probe(s *service, exited <-chan struct{}) {
+	p := s.spec.Ready
+	if !p.Set() {
+		s.markReady(true)
+		return
+	}
+	timeout, _ := p.TimeoutDuration() // validated by cfg.ServiceOrder
+	deadline := time.After(timeout)
+	tick := time.NewTicker(probeInterval)
+	defer tick.Stop()
+	for {
+		passed := sup.check(s)
+		select {
+		case <-exited: // a check that raced the exit says nothing about the next process
+			return
+		default:
+		}
+		if passed {
+			s.markReady(true)
+			fmt.Println(ok("✓") + " " + s.label + " ready")
+			sup.setState(s, "ready", 0)
+			return
+		}
+		select {
+		case <-tick.C:
+		case <-deadline:
+			fmt.Fprintf(os.Stderr, "%s %s not ready after %s\n", warn("!"), s.name, timeout)
+			s.markReady(false)
+			return
+		case <-exited:
+			return
+		case <-sup.stopping:
+			return
+		}
+	}
+}
+
+// check runs the readiness check once.
+func (sup *supervisor) check(s *service) bool {
+	p := s.spec.Ready
+	switch {
+	case p.TCP != 0:
+		conn, err := net.DialTimeout("tcp", s.hostAddr(p.TCP), time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	case p.HTTP != "":
+		resp, err := probeClient.Get(s.hostURL(p.HTTP))
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	case p.Cmd != "":
+		// same sandbox, env and cwd as the service itself
+		opts := s.opts(sup.base, p.Cmd)
+		if s.net != nil {
+			s.net.apply(&opts, false)
+		}
+		c, err := sandbox.Build(s.cfg, sup.env, sup.project, opts)
+		if err != nil {
+			return false
+		}
+		defer sandbox.CloseFiles(c)
+		return c.Run() == nil
+	}
+	return true
+}
+
+// hostAddr maps a localhost port inside the service's sandbox to where the host
+// reaches it. ports that aren't published are assumed to be on the host network.
+func (s *service) hostAddr(port int) string {
+	for _, p := range s.ports {
+		if p.SandboxPort == port {
+			return net.JoinHostPort(dialHost(p.HostIP), strconv.Itoa(p.HostPort))
+		}
+	}
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
+
+// hostURL rewrites a localhost probe URL to the service's published host port.
+func (s *service) hostURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1") || u.Port() == "" {
+		return raw
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return raw
+	}
+	u.Host = s.hostAddr(port)
+	return u.String()
+}
+
+// shouldRestart applies a service's restart policy to an exit.
+func shouldRestart(policy string, failed bool) bool {
+	switch policy {
+	case "always":
+		return true
+	case "on-failure":
+		return failed
+	}
+	return false
+}
+
+// closeNets releases the host side of every service's network.
+func (sup *supervisor) closeNets() {
+	for _, s := range sup.svcs {
+		if s.net != nil {
+			s.net.close()
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/imraghavojha/lagoon/internal/sandbox"
+)
+
+const (
+	// timeoutGrace is how long a timed-out sandbox gets between SIGTERM and SIGKILL
+	timeoutGrace = 5 * time.Second
+	// timeoutExit is the exit status after a timeout — the same as coreutils timeout
+	timeoutExit = 124
+)
+
+// stopSandbox ends the sandbox started by c: SIGTERM to every process in it, then
+// SIGKILL to its init after timeoutGrace, which takes the whole namespace down.
+func stopSandbox(c *exec.Cmd, infoPath string, exited <-chan struct{}) {
+	pid, err := sandbox.ReadInfo(infoPath)
+	if err != nil || parentPID(pid) != c.Process.Pid {
+		// not set up yet, or a recycled pid. bwrap runs the sandbox with --die-with-parent, so killing it is enough
+		c.Process.Kill()
+		return
+	}
+	sandbox.Signal(pid, syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(timeoutGrace):
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+}
+
+// parentPID reads a process's parent from /proc/<pid>/status, or 0 if it's gone.
+func parentPID(pid int) int {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if v, ok := strings.CutPrefix(line, "PPid:"); ok {
+			ppid, _ := strconv.Atoi(strings.TrimSpace(v))
+			return ppid
+		}
+	}
+	return 0
+}
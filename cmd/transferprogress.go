@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// byteCount counts bytes as they pass through a reader or writer.
+type byteCount struct {
+	n atomic.Int64
+}
+
+func (c *byteCount) Write(p []byte) (int, error) {
+	c.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+type countingReader struct {
+	r     io.Reader
+	count *byteCount
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.count.n.Add(int64(n))
+	return n, err
+}
+
+type transferModel struct {
+	bar   progress.Model
+	label string
+	count *byteCount
+	total int64
+	start time.Time
+}
+
+type (
+	transferTickMsg struct{}
+	transferDoneMsg struct{}
+)
+
+func transferTick() tea.Cmd {
+	return tea.Tick(100*time.Millisecond, func(time.Time) tea.Msg { return transferTickMsg{} })
+}
+
+func (m transferModel) Init() tea.Cmd {
+	return transferTick()
+}
+
+func (m transferModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg.(type) {
+	case transferDoneMsg:
+		return m, tea.Quit
+	case transferTickMsg:
+		return m, transferTick()
+	}
+	return m, nil
+}
+
+func (m transferModel) View() string {
+	done := m.count.n.Load()
+	pct := 0.0
+	if m.total > 0 {
+		pct = min(float64(done)/float64(m.total), 1)
+	}
+	rate := ""
+	if secs := time.Since(m.start).Seconds(); secs >= 1 {
+		rate = humanBytes(int64(float64(done)/secs)) + "/s"
+	}
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	return fmt.Sprintf("\n  %s %s\n  %s / %s  %s\n\n",
+		m.label,
+		m.bar.ViewAs(pct),
+		humanBytes(done),
+		humanBytes(m.total),
+		dim.Render(rate),
+	)
+}
+
+// withTransferProgress runs work while drawing a byte progress bar on stderr, which
+// stays free while stdout carries a bundle. without a terminal it just runs work.
+func withTransferProgress(label string, total int64, count *byteCount, work func() error) error {
+	if info, err := os.Stderr.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return work()
+	}
+	m := transferModel{
+		bar:   progress.New(progress.WithDefaultGradient(), progress.WithWidth(40)),
+		label: label,
+		count: count,
+		total: total,
+		start: time.Now(),
+	}
+	// no input: stdin may be the terminal the user pipes into, and ctrl+c should just stop us
+	p := tea.NewProgram(m, tea.WithOutput(os.Stderr), tea.WithInput(nil))
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- work()
+		p.Send(transferDoneMsg{})
+	}()
+	if _, err := p.Run(); errors.Is(err, tea.ErrInterrupted) {
+		return err
+	}
+	return <-errCh
+}
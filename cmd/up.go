@@ -5,18 +5,14 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"runtime"
-	"sort"
-	"sync"
+	"slices"
+	"strings"
 	"syscall"
-	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/imraghavojha/lagoon/internal/config"
-	"github.com/imraghavojha/lagoon/internal/nix"
 	"github.com/imraghavojha/lagoon/internal/preflight"
 	"github.com/imraghavojha/lagoon/internal/sandbox"
 	"github.com/spf13/cobra"
@@ -30,15 +26,44 @@ var upCmd = &cobra.Command{
 Starts every service in the [up] section of lagoon.toml inside the sandbox.
 Services bind to real localhost ports — access them from your browser or
 other tools on the host exactly as you would with docker-compose up.
+A service that lists ports gets no other network: only those ports are
+published, and other services' ports appear on its localhost.
 
   [up]
   web = "node server.js"
-  api = "python3 -m flask run --port 8080"
 
-Ctrl+C to stop all services.`,
+  [up.api]
+  cmd = "python3 -m flask run --port 8080"
+  depends_on = ["db"]                       # start after db is ready
+  ready = { http = "http://localhost:8080/health" }  # or tcp = 8080, or cmd = "..."
+  restart = "on-failure"                    # or "always"; retries back off up to 30s
+  env = { FLASK_ENV = "development" }
+  cwd = "backend"                           # relative to /workspace
+  ports = ["8080:8080"]                     # host:sandbox, bound on 127.0.0.1
+
+Ctrl+C to stop all services.
+
+With -d, services keep running in the background:
+  lagoon up -d          start detached
+  lagoon logs -f api    follow a service's output
+  lagoon ps             list detached services and their state
+  lagoon down           stop them`,
 	RunE: runUp,
 }
 
+var (
+	detachFlag    bool
+	superviseFlag bool
+)
+
+func init() {
+	upCmd.Flags().BoolVarP(&detachFlag, "detach", "d", false, "run services in the background")
+	addLockFlags(upCmd)
+	// set on the background supervisor spawned by -d; not meant to be passed by hand
+	upCmd.Flags().BoolVar(&superviseFlag, "supervise", false, "")
+	upCmd.Flags().MarkHidden("supervise")
+}
+
 // svcColors cycles through distinct terminal colors for service prefixes
 var svcColors = []string{"12", "14", "10", "11", "13"}
 
@@ -50,6 +75,14 @@ func runUp(cmd *cobra.Command, args []string) error {
 	if len(cfg.Up) == 0 {
 		return fmt.Errorf("no services defined in lagoon.toml\n\n  add an [up] section:\n\n  [up]\n  web = \"node server.js\"")
 	}
+	// dependency order doubles as start order and color assignment
+	names, err := cfg.ServiceOrder()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Limits.Check(); err != nil {
+		return fmt.Errorf("limits: %w", err)
+	}
 
 	if err := preflight.RunAll(); err != nil {
 		fmt.Fprintln(os.Stderr, fail("✗")+" "+err.Error())
@@ -61,122 +94,160 @@ func runUp(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	cacheDir := projectCacheDir(absPath)
-	shellNixPath := filepath.Join(cacheDir, "shell.nix")
 
-	sum, err := nix.GenerateShellNix(cfg, shellNixPath)
-	if err != nil {
-		return fmt.Errorf("generating shell.nix: %w", err)
+	// one set of services per project — a second one would fight over the same ports
+	if st, err := readUpState(cacheDir); err == nil && st.running() && !superviseFlag {
+		return fmt.Errorf("services already running in the background (pid %d) — run 'lagoon down' first", st.PID)
 	}
 
-	resolved, hit := nix.LoadCache(cacheDir, sum)
-	if hit {
-		if _, err := os.Stat(resolved.BashPath); err != nil {
-			hit = false
+	resolved, sum, err := resolveEnv(cfg, absPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	// checked once, before detaching — the supervisor runs what was checked
+	if !superviseFlag {
+		if err := checkLock(cfg, resolved, sum, ignoreLockFlag, updateLockFlag); err != nil {
+			fmt.Fprintln(os.Stderr, fail("✗")+" "+err.Error())
+			os.Exit(1)
 		}
 	}
 
-	if !hit {
-		if runtime.GOARCH == "arm64" {
-			fmt.Println(warn("!") + " arm: first run may take 10-60 min to compile packages")
-		}
-		env, err := resolveWithProgress(shellNixPath)
+	// the env is built and cached now, so the background supervisor starts instantly
+	if detachFlag {
+		// read here, while there's a terminal for prompts and pass or op to ask on —
+		// the supervisor has none, and gets the values over a pipe
+		secrets, err := sandboxSecrets(cfg, absPath)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
+			return err
 		}
-		resolved = env
-		_ = nix.SaveCache(cacheDir, resolved, sum)
+		if err := spawnDetached(cacheDir, absPath, secrets); err != nil {
+			return err
+		}
+		fmt.Printf("%s started %d service(s) in the background\n", ok("✓"), len(names))
+		fmt.Println("  lagoon logs -f   follow their output")
+		fmt.Println("  lagoon down      stop them")
+		return nil
 	}
-	nix.CreateGCRoots(cacheDir, resolved)
-
-	// services always need --share-net so ports bind to the host network
-	netCfg := *cfg
-	netCfg.Profile = "network"
-
-	fmt.Println(warn("!") + " services run with network access enabled")
 
-	// sort names for deterministic start order and color assignment
-	names := make([]string, 0, len(cfg.Up))
-	for n := range cfg.Up {
-		names = append(names, n)
+	// services that publish ports keep the project's network profile and are reached
+	// only through them; the rest share the host network so their ports bind there
+	published := map[string][]config.Port{}
+	var shared []string
+	for _, name := range names {
+		published[name], _ = config.ParsePorts(cfg.Up[name].Ports) // validated by ServiceOrder
+		if cfg.Profile != "allowlist" && len(published[name]) == 0 {
+			shared = append(shared, name)
+		}
 	}
-	sort.Strings(names)
-
-	type proc struct {
-		cmd  *exec.Cmd
-		done chan struct{}
-		pw   *io.PipeWriter
+	if len(shared) > 0 && cfg.Profile != "network" {
+		fmt.Printf("%s %s run with network access enabled — add ports to isolate them\n",
+			warn("!"), strings.Join(shared, ", "))
 	}
-	procs := make([]proc, 0, len(names))
-
-	for i, name := range names {
-		color := svcColors[i%len(svcColors)]
-		style := lipgloss.NewStyle().Foreground(lipgloss.Color(color)).Bold(true)
-		prefix := style.Render(fmt.Sprintf("%-12s", name)+" |") + " "
 
-		pr, pw := io.Pipe()
-		c, err := sandbox.Build(&netCfg, resolved, absPath, cfg.Up[name], "", nil)
+	binds, err := sandboxBinds(cfg, absPath, nil)
+	if err != nil {
+		return err
+	}
+	// a service's own env is applied on top of these
+	envs, err := sandboxEnvs(cfg, absPath, nil)
+	if err != nil {
+		return err
+	}
+	// read once, then handed to every start and restart
+	var secrets []sandbox.Secret
+	if superviseFlag {
+		secrets, err = inheritedSecrets()
+	} else {
+		secrets, err = sandboxSecrets(cfg, absPath)
+	}
+	if err != nil {
+		return err
+	}
+	// [limits] caps each service's sandbox separately
+	sup := newSupervisor(cfg, resolved, absPath, sandbox.Options{Binds: binds, Limits: cfg.Limits, ExtraEnvs: envs, Secrets: secrets})
+	addService := func(name, prefix, label string, out io.Writer) error {
+		svcCfg, netw, err := serviceNet(cfg, name, names, published)
 		if err != nil {
-			// close already-open pipes before returning
-			for _, p := range procs {
-				p.pw.Close()
+			sup.closeNets()
+			return fmt.Errorf("service %q: %w", name, err)
+		}
+		s := sup.add(name, cfg.Up[name], prefix, label, out)
+		s.cfg, s.net, s.ports = svcCfg, netw, published[name]
+		return nil
+	}
+	var rec *upRecorder
+	if superviseFlag {
+		// detached: raw output per service in logs/, state in up.json
+		rec = newUpRecorder(cacheDir, absPath, names)
+		sup.onState = rec.set
+		for _, name := range names {
+			f, err := os.Create(serviceLogPath(cacheDir, name))
+			if err != nil {
+				sup.closeNets()
+				return err
+			}
+			defer f.Close()
+			if err := addService(name, "", name, f); err != nil {
+				return err
 			}
-			return fmt.Errorf("building sandbox for %q: %w", name, err)
 		}
-		c.Stdout = pw
-		c.Stderr = pw
-		if err := c.Start(); err != nil {
-			pw.Close()
-			for _, p := range procs {
-				p.pw.Close()
+	} else {
+		for i, name := range names {
+			style := svcStyle(i)
+			prefix := style.Render(fmt.Sprintf("%-12s", name)+" |") + " "
+			if err := addService(name, prefix, style.Render(name), os.Stdout); err != nil {
+				return err
 			}
-			return fmt.Errorf("starting %q: %w", name, err)
 		}
-
-		done := make(chan struct{})
-		go func() { c.Wait(); close(done) }()
-
-		// stream output with colored prefix
-		go prefixLines(os.Stdout, prefix, pr)
-
-		// print unexpected exits as warnings
-		go func(n string, d chan struct{}) {
-			<-d
-			fmt.Fprintln(os.Stderr, warn("!")+" service "+n+" exited")
-		}(name, done)
-
-		procs = append(procs, proc{cmd: c, done: done, pw: pw})
-		fmt.Println(ok("→")+" "+style.Render(name))
 	}
-	fmt.Println()
+	sup.start()
 
+	// 'lagoon down' sends SIGTERM to the detached supervisor
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	<-sigs
 
 	fmt.Println("\nstopping services…")
-	var wg sync.WaitGroup
-	for _, p := range procs {
-		wg.Add(1)
-		go func(p proc) {
-			defer wg.Done()
-			if p.cmd.Process == nil {
-				return
-			}
-			p.cmd.Process.Signal(syscall.SIGTERM)
-			select {
-			case <-p.done:
-			case <-time.After(500 * time.Millisecond):
-				p.cmd.Process.Kill()
-				<-p.done
-			}
-			p.pw.Close()
-		}(p)
+	sup.stop()
+	if rec != nil {
+		rec.finish()
 	}
-	wg.Wait()
 	return nil
 }
 
+// serviceNet picks the network for one service. one that publishes ports (or runs
+// under the allowlist profile) gets its own helper; other services' published ports
+// appear on its localhost at their host port numbers. the rest share the host network.
+func serviceNet(cfg *config.Config, name string, names []string, published map[string][]config.Port) (*config.Config, *sandboxNet, error) {
+	own := published[name]
+	if cfg.Profile == "network" || (cfg.Profile != "allowlist" && len(own) == 0) {
+		hostNet := *cfg
+		hostNet.Profile = "network"
+		return &hostNet, nil, nil
+	}
+	var connect []config.Port
+	for _, other := range names {
+		if other == name {
+			continue
+		}
+		for _, p := range published[other] {
+			// the service's own ports win — it listens on them itself
+			if slices.ContainsFunc(own, func(o config.Port) bool { return o.SandboxPort == p.HostPort }) {
+				continue
+			}
+			connect = append(connect, config.Port{HostIP: p.HostIP, HostPort: p.HostPort, SandboxPort: p.HostPort})
+		}
+	}
+	netw, err := startNet(cfg, own, connect)
+	return cfg, netw, err
+}
+
+// svcStyle is the prefix style for the i-th service in start order.
+func svcStyle(i int) lipgloss.Style {
+	return lipgloss.NewStyle().Foreground(lipgloss.Color(svcColors[i%len(svcColors)])).Bold(true)
+}
+
 // prefixLines reads lines from src and writes each to dst with the given prefix.
 func prefixLines(dst io.Writer, prefix string, src io.Reader) {
 	s := bufio.NewScanner(src)
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/nix"
+	"github.com/spf13/cobra"
+)
+
+// nixpkgsChannel is where update looks without --commit; the default pin tracks the same channel
+const nixpkgsChannel = "nixpkgs-unstable"
+
+var (
+	updateCommit string
+	updateYes    bool
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "move lagoon.toml to a newer nixpkgs and show what changes",
+	Long: `lagoon update                 pin the latest ` + nixpkgsChannel + `
+lagoon update --commit <rev>
+
+Prefetches the new nixpkgs, resolves the environment at both the old and new
+pin, and prints every package whose version changes. nixpkgs_commit and
+nixpkgs_sha256 in lagoon.toml are only rewritten once you confirm.`,
+	RunE: runUpdate,
+}
+
+func init() {
+	updateCmd.Flags().StringVar(&updateCommit, "commit", "", "pin this nixpkgs commit (full 40-char hash)")
+	updateCmd.Flags().BoolVarP(&updateYes, "yes", "y", false, "rewrite lagoon.toml without asking")
+}
+
+func runUpdate(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Read(config.Filename)
+	if err != nil {
+		return fmt.Errorf("no lagoon.toml — run 'lagoon init' first")
+	}
+	if cfg.UsesFlakes() {
+		return fmt.Errorf("this project pins nixpkgs through a flake — run 'nix flake update' or edit nixpkgs in lagoon.toml")
+	}
+
+	commit := updateCommit
+	if commit == "" {
+		fmt.Println(ok("→") + " looking up the latest " + nixpkgsChannel + "…")
+		if commit, err = latestNixpkgs(); err != nil {
+			return fmt.Errorf("looking up %s: %w", nixpkgsChannel, err)
+		}
+	}
+	if len(commit) != 40 {
+		return fmt.Errorf("--commit must be a full 40-char git hash (got %d chars)", len(commit))
+	}
+	if commit == cfg.NixpkgsCommit {
+		fmt.Println(ok("✓") + " already at " + commit[:8])
+		return nil
+	}
+
+	fmt.Println(ok("→") + " prefetching nixpkgs " + commit[:8] + "…")
+	sha, err := prefetchNixpkgs(commit)
+	if err != nil {
+		return err
+	}
+
+	absPath, err := filepath.Abs(".")
+	if err != nil {
+		return err
+	}
+	// the current pin is usually cached already
+	oldEnv, _, err := resolveEnv(cfg, absPath)
+	if err != nil {
+		return err
+	}
+	// nothing is saved for the new env until the update is accepted
+	next := *cfg
+	next.NixpkgsCommit, next.NixpkgsSHA256 = commit, sha
+	src, err := nix.Prepare(&next, envBase(), absPath)
+	if err != nil {
+		return err
+	}
+	// held until the answer is in: a declined update removes the dir it created
+	_, statErr := os.Stat(src.Dir)
+	created := os.IsNotExist(statErr)
+	unlock, err := nix.LockEnv(src.Dir, nil)
+	if err != nil {
+		return fmt.Errorf("locking environment cache: %w", err)
+	}
+	defer unlock()
+	accepted := false
+	defer func() {
+		if created && !accepted {
+			os.RemoveAll(src.Dir)
+		}
+	}()
+	if err := src.Write(); err != nil {
+		return err
+	}
+	newEnv, hit := nix.LoadCache(src.Dir, src.Sum)
+	if !hit {
+		newEnv, err = resolveWithProgress(src)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n  nixpkgs %s → %s\n\n", cfg.NixpkgsCommit[:8], commit[:8])
+	printVersionDiff(nix.Versions(oldEnv), nix.Versions(newEnv))
+	fmt.Println()
+
+	if !updateYes {
+		var confirm bool
+		if err := huh.NewConfirm().
+			Title("update lagoon.toml to " + commit[:8] + "?").
+			Affirmative("yes").
+			Negative("no").
+			Value(&confirm).
+			Run(); err != nil {
+			return err
+		}
+		if !confirm {
+			fmt.Println("  not updated.")
+			return nil
+		}
+	}
+
+	if err := config.SetPin(config.Filename, commit, sha); err != nil {
+		return err
+	}
+	accepted = true
+	// already resolved — 'lagoon lock' starts from cache
+	_ = nix.SaveCache(src.Dir, newEnv, src.Sum)
+	fmt.Println(ok("✓") + " lagoon.toml now pins nixpkgs " + commit[:8])
+	fmt.Println(warn("!") + " run 'lagoon lock' to refresh lagoon.lock, then commit both")
+	return nil
+}
+
+// latestNixpkgs returns the commit the channel currently points at.
+func latestNixpkgs() (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get("https://channels.nixos.org/" + nixpkgsChannel + "/git-revision")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("channels.nixos.org: %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// prefetchNixpkgs downloads the nixpkgs tarball for commit into the store and
+// returns the sha256 that fetchTarball expects.
+func prefetchNixpkgs(commit string) (string, error) {
+	url := "https://github.com/NixOS/nixpkgs/archive/" + commit + ".tar.gz"
+	c := exec.Command("nix-prefetch-url", "--unpack", url)
+	c.Stderr = os.Stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("nix-prefetch-url: %w", err)
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) == 0 || len(lines[len(lines)-1]) != 52 {
+		return "", fmt.Errorf("nix-prefetch-url printed no hash for %s", url)
+	}
+	return lines[len(lines)-1], nil
+}
+
+// printVersionDiff lists packages whose version differs between two environments.
+func printVersionDiff(before, after map[string]string) {
+	names := map[string]bool{}
+	for n := range before {
+		names[n] = true
+	}
+	for n := range after {
+		names[n] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	changed := 0
+	for _, n := range sorted {
+		old, hadOld := before[n]
+		cur, hasNew := after[n]
+		switch {
+		case !hadOld:
+			fmt.Printf("  %s %-24s %s\n", ok("+"), n, cur)
+		case !hasNew:
+			fmt.Printf("  %s %-24s %s\n", fail("-"), n, old)
+		case old != cur:
+			fmt.Printf("  %s %-24s %s → %s\n", warn("~"), n, old, cur)
+		default:
+			continue
+		}
+		changed++
+	}
+	if changed == 0 {
+		fmt.Println("  no package versions change — only rebuilds")
+	}
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+)
+
+// sandboxEnvs returns the extra variables for a sandbox, lowest precedence first:
+// env_files in order, then [env], then passthrough from the host, then -e flags.
+func sandboxEnvs(cfg *config.Config, projectPath string, flags []string) ([]string, error) {
+	var envs []string
+	for _, f := range cfg.EnvFiles {
+		path := f
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectPath, f)
+		}
+		fileEnvs, err := config.ReadEnvFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("env_files: %w", err)
+		}
+		envs = append(envs, fileEnvs...)
+	}
+	keys := make([]string, 0, len(cfg.Env))
+	for k := range cfg.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		envs = append(envs, k+"="+cfg.Env[k])
+	}
+	// unset host vars stay unset rather than becoming empty
+	for _, k := range cfg.Passthrough {
+		if v, ok := os.LookupEnv(k); ok {
+			envs = append(envs, k+"="+v)
+		}
+	}
+	return append(envs, flags...), nil
+}
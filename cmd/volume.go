@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/sandbox"
+	"github.com/spf13/cobra"
+)
+
+var volumeCmd = &cobra.Command{
+	Use:   "volume",
+	Short: "manage named volumes that persist sandbox directories",
+	Long: `lagoon volume ls|rm|inspect
+
+Volumes are declared in lagoon.toml and mounted into every sandbox of the project.
+Everything not listed stays ephemeral.
+
+  [volumes]
+  "~/.cache" = "pipcache"
+  "~/.npm" = "npmcache"
+
+Volumes live under the lagoon cache dir and are shared by every project that names them.`,
+}
+
+var volumeLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "list named volumes",
+	Args:  cobra.NoArgs,
+	RunE:  runVolumeLs,
+}
+
+var volumeRmCmd = &cobra.Command{
+	Use:   "rm <name>...",
+	Short: "delete named volumes and everything in them",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runVolumeRm,
+}
+
+var volumeInspectCmd = &cobra.Command{
+	Use:   "inspect <name>",
+	Short: "show where a volume lives, its size, and where this project mounts it",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runVolumeInspect,
+}
+
+func init() {
+	volumeCmd.AddCommand(volumeLsCmd, volumeRmCmd, volumeInspectCmd)
+}
+
+// volumeBase holds one directory per named volume.
+func volumeBase() string {
+	return filepath.Join(lagoonCacheBase(), "volumes")
+}
+
+// volumeBinds validates cfg's [volumes] and returns them as sandbox mounts,
+// creating volume directories on first use.
+func volumeBinds(cfg *config.Config) ([]sandbox.Bind, error) {
+	targets := make([]string, 0, len(cfg.Volumes))
+	for t := range cfg.Volumes {
+		targets = append(targets, t)
+	}
+	// parents before children, so a volume inside another volume's path isn't hidden by it
+	sort.Strings(targets)
+
+	binds := make([]sandbox.Bind, 0, len(targets))
+	for _, target := range targets {
+		name := cfg.Volumes[target]
+		if err := config.CheckVolume(target, name); err != nil {
+			return nil, err
+		}
+		dir := filepath.Join(volumeBase(), name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("creating volume %q: %w", name, err)
+		}
+		binds = append(binds, sandbox.Bind{Source: dir, Target: target})
+	}
+	return binds, nil
+}
+
+func runVolumeLs(cmd *cobra.Command, args []string) error {
+	entries, err := os.ReadDir(volumeBase())
+	if err != nil || len(entries) == 0 {
+		fmt.Println("  no volumes yet — declare them under [volumes] in lagoon.toml")
+		return nil
+	}
+	used := projectVolumes()
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		size, _, mod := dirStats(filepath.Join(volumeBase(), e.Name()))
+		mark := "  "
+		if len(used[e.Name()]) > 0 {
+			mark = ok("●") + " "
+		}
+		fmt.Printf("  %s%-20s  %9s  %s\n", mark, e.Name(), humanBytes(size), mod.Format("2006-01-02 15:04"))
+	}
+	if len(used) > 0 {
+		fmt.Println("\n  " + ok("●") + " used by this project")
+	}
+	return nil
+}
+
+func runVolumeRm(cmd *cobra.Command, args []string) error {
+	for _, name := range args {
+		// the name becomes a path — don't let "../x" escape the volumes dir
+		if err := config.CheckVolumeName(name); err != nil {
+			return err
+		}
+		dir := filepath.Join(volumeBase(), name)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			fmt.Println(warn("!") + " no volume named " + name)
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("removing volume %q: %w", name, err)
+		}
+		fmt.Println(ok("✓") + " removed volume " + name)
+	}
+	return nil
+}
+
+func runVolumeInspect(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if err := config.CheckVolumeName(name); err != nil {
+		return err
+	}
+	dir := filepath.Join(volumeBase(), name)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("no volume named %q", name)
+	}
+	size, files, mod := dirStats(dir)
+	fmt.Println("  name:      " + name)
+	fmt.Println("  path:      " + dir)
+	fmt.Printf("  size:      %s in %d file(s)\n", humanBytes(size), files)
+	fmt.Println("  modified:  " + mod.Format(time.RFC3339))
+	for _, target := range projectVolumes()[name] {
+		fmt.Println("  mounted:   " + target + " (this project)")
+	}
+	return nil
+}
+
+// projectVolumes maps volume name → sandbox targets for the lagoon.toml in the
+// current directory, if there is one.
+func projectVolumes() map[string][]string {
+	used := map[string][]string{}
+	cfg, err := config.Read(config.Filename)
+	if err != nil {
+		return used
+	}
+	for _, target := range slices.Sorted(maps.Keys(cfg.Volumes)) {
+		name := cfg.Volumes[target]
+		used[name] = append(used[name], target)
+	}
+	return used
+}
+
+// dirStats walks dir and returns total size, file count and newest modification time.
+func dirStats(dir string) (size int64, files int, newest time.Time) {
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files, newest
+}
+
+// humanBytes formats n as a short size like "12.3 MiB".
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
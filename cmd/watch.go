@@ -16,6 +16,8 @@ var watchCmd = &cobra.Command{
 
 Starts the command inside the sandbox and watches the project directory for
 file changes, restarting automatically when anything changes.
+Each restart goes through 'lagoon run', so [env], env_files and passthrough
+are re-read every time.
 Requires watchexec on PATH — add it to your lagoon.toml packages.`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: runWatch,
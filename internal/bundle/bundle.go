@@ -0,0 +1,300 @@
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/imraghavojha/lagoon/internal/nix"
+)
+
+// a bundle is a tar: manifest.json first, manifest.sig if signed, then one NAR
+// per store path in manifest order, so both ends can stream it without seeking.
+const (
+	manifestName = "manifest.json"
+	sigName      = "manifest.sig"
+	narDir       = "nar/"
+	Version      = 1
+)
+
+// Manifest describes a bundle: enough to check every byte of it and to seed the
+// environment cache on the loading machine without running nix-shell.
+type Manifest struct {
+	Version       int             `json:"version"`
+	Created       time.Time       `json:"created"`
+	Config        string          `json:"config"`                  // the lagoon.toml the environment was built from
+	Sum           string          `json:"sum"`                     // environment sum, names its cache dir
+	Env           nix.ResolvedEnv `json:"env"`                     // what env.json gets seeded with
+	ClosureSHA256 string          `json:"closure_sha256"`          // same hash lagoon.lock records
+	Paths         []nix.PathInfo  `json:"paths"`                   // the bundled paths, dependencies first
+	Prerequisites []string        `json:"prerequisites,omitempty"` // rest of the closure, left out by save --since
+}
+
+// StorePaths lists the whole closure: prerequisites, then the bundled paths.
+func (m *Manifest) StorePaths() []string {
+	paths := slices.Clone(m.Prerequisites)
+	for _, p := range m.Paths {
+		paths = append(paths, p.Path)
+	}
+	return paths
+}
+
+// check makes sure the manifest is self-consistent before anything is imported.
+func (m *Manifest) check() error {
+	if m.Version != Version {
+		return fmt.Errorf("bundle version %d not supported (this lagoon reads version %d)", m.Version, Version)
+	}
+	if m.Sum == "" || len(m.StorePaths()) == 0 {
+		return fmt.Errorf("bundle manifest is incomplete")
+	}
+	if sum := nix.ClosureSum(m.StorePaths()); sum != m.ClosureSHA256 {
+		return fmt.Errorf("bundle closure doesn't match its closure_sha256")
+	}
+	// import order matters: nix refuses a path whose references aren't valid yet
+	seen := map[string]bool{}
+	for _, p := range m.Prerequisites {
+		seen[p] = true
+	}
+	for _, p := range m.Paths {
+		if _, err := nix.ParseSHA256(p.NarHash); err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		for _, ref := range p.References {
+			if ref != p.Path && !seen[ref] {
+				return fmt.Errorf("%s references %s, which is neither earlier in the bundle nor a prerequisite", p.Path, ref)
+			}
+		}
+		seen[p.Path] = true
+	}
+	if !inClosure(m.Env.BashPath, seen) {
+		return fmt.Errorf("bundle's bash %s is not in its closure", m.Env.BashPath)
+	}
+	return nil
+}
+
+// inClosure reports whether file lives under one of the store paths.
+func inClosure(file string, paths map[string]bool) bool {
+	rest, found := strings.CutPrefix(file, "/nix/store/")
+	if !found {
+		return false
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	return paths["/nix/store/"+name]
+}
+
+// narName is the tar entry holding a path's NAR.
+func narName(path string) string {
+	return narDir + filepath.Base(path) + ".nar"
+}
+
+// Write streams a bundle for m to w, dumping each path from the local store and
+// checking it against the hash nix registered for it. with a key, the manifest is
+// signed — it holds every NAR's hash, so that covers the whole bundle. NAR bytes
+// are also copied to progress, if set, to measure against the total NarSize.
+func Write(w io.Writer, m *Manifest, key *nix.SecretKey, progress io.Writer) error {
+	if progress == nil {
+		progress = io.Discard
+	}
+	// tar needs every entry's size up front; nix-store --dump-db leaves it out for
+	// paths registered by very old nix versions
+	for _, p := range m.Paths {
+		if p.NarSize <= 0 {
+			return fmt.Errorf("%s has no NAR size in the nix database, so it can't be bundled", p.Path)
+		}
+	}
+	m.Version = Version
+	m.ClosureSHA256 = nix.ClosureSum(m.StorePaths())
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	if err := writeEntry(tw, manifestName, int64(len(data)), m.Created, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}); err != nil {
+		return err
+	}
+	if key != nil {
+		sig := []byte(key.Sign(data) + "\n")
+		if err := writeEntry(tw, sigName, int64(len(sig)), m.Created, func(w io.Writer) error {
+			_, err := w.Write(sig)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	for _, p := range m.Paths {
+		h := sha256.New()
+		if err := writeEntry(tw, narName(p.Path), p.NarSize, m.Created, func(w io.Writer) error {
+			return nix.DumpPath(p.Path, io.MultiWriter(w, h, progress))
+		}); err != nil {
+			return fmt.Errorf("%s: %w", p.Path, err)
+		}
+		if nix.FormatSHA256(h.Sum(nil)) != p.NarHash {
+			return fmt.Errorf("%s doesn't match its registered hash — run 'nix-store --verify --check-contents'", p.Path)
+		}
+	}
+	return tw.Close()
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, mtime time.Time, body func(io.Writer) error) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: mtime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	return body(tw)
+}
+
+// Reader reads a bundle. the manifest is read and checked up front; the NARs
+// stream straight into the store on Import.
+type Reader struct {
+	Manifest   *Manifest
+	Signatures []string // from manifest.sig, unchecked until Verify
+	raw        []byte
+	tr         *tar.Reader
+	next       *tar.Header // read past the manifest while looking for a signature
+}
+
+// NewReader reads the manifest from the start of r.
+func NewReader(r io.Reader) (*Reader, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, fmt.Errorf("not a lagoon bundle (no %s) — files from older versions of 'lagoon save' can be imported with nix-store --import", manifestName)
+	}
+	raw, err := io.ReadAll(tr)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", manifestName, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", manifestName, err)
+	}
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	br := &Reader{Manifest: &m, raw: raw, tr: tr}
+	hdr, err = tr.Next()
+	switch {
+	case err == nil && hdr.Name == sigName:
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", sigName, err)
+		}
+		br.Signatures = strings.Fields(string(b))
+	case err == nil:
+		br.next = hdr
+	case !errors.Is(err, io.EOF):
+		return nil, err
+	}
+	return br, nil
+}
+
+// Verify checks the manifest against trusted keys and returns the key that
+// signed it. the NARs are covered too, since Import checks them against the manifest.
+func (r *Reader) Verify(trusted []*nix.PublicKey) (*nix.PublicKey, error) {
+	if len(r.Signatures) == 0 {
+		return nil, fmt.Errorf("bundle is not signed")
+	}
+	for _, k := range trusted {
+		for _, sig := range r.Signatures {
+			if k.Verify(r.raw, sig) {
+				return k, nil
+			}
+		}
+	}
+	names := make([]string, len(r.Signatures))
+	for i, sig := range r.Signatures {
+		names[i] = nix.SignerName(sig)
+	}
+	return nil, fmt.Errorf("bundle signature doesn't match any trusted key (signed by %s)", strings.Join(names, ", "))
+}
+
+// nextHeader returns the next tar entry, including one NewReader already read.
+func (r *Reader) nextHeader() (*tar.Header, error) {
+	if hdr := r.next; hdr != nil {
+		r.next = nil
+		return hdr, nil
+	}
+	return r.tr.Next()
+}
+
+// ReadManifest reads just the manifest of the bundle at path.
+func ReadManifest(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	plain, err := Decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	defer plain.Close()
+	r, err := NewReader(plain)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r.Manifest, nil
+}
+
+// MissingPrerequisites lists the prerequisites this machine's store doesn't have.
+func (m *Manifest) MissingPrerequisites() ([]string, error) {
+	if len(m.Prerequisites) == 0 {
+		return nil, nil
+	}
+	return nix.InvalidPaths(m.Prerequisites)
+}
+
+// Import feeds every NAR into nix-store --import, hashing each on the way. a path
+// is only registered once its NAR has matched the manifest; on a mismatch the
+// import is aborted and nothing from that path on is added.
+func (r *Reader) Import() error {
+	if len(r.Manifest.Paths) == 0 {
+		return nil
+	}
+	im, err := nix.StartImport()
+	if err != nil {
+		return err
+	}
+	for _, p := range r.Manifest.Paths {
+		if err := r.importPath(im, p); err != nil {
+			im.Abort()
+			return err
+		}
+	}
+	return im.Finish()
+}
+
+func (r *Reader) importPath(im *nix.Importer, p nix.PathInfo) error {
+	hdr, err := r.nextHeader()
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("bundle is truncated: %s is missing", p.Path)
+	}
+	if err != nil {
+		return err
+	}
+	if hdr.Name != narName(p.Path) || hdr.Size != p.NarSize {
+		return fmt.Errorf("bundle is corrupt: expected %s (%d bytes), found %s (%d bytes)", narName(p.Path), p.NarSize, hdr.Name, hdr.Size)
+	}
+	if err := im.StartPath(); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(im, h), r.tr); err != nil {
+		return err
+	}
+	if got := nix.FormatSHA256(h.Sum(nil)); got != p.NarHash {
+		return fmt.Errorf("%s: hash mismatch\n  manifest: %s\n  bundle:   %s", p.Path, p.NarHash, got)
+	}
+	return im.EndPath(p)
+}
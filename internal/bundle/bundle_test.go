@@ -0,0 +1,187 @@
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imraghavojha/lagoon/internal/nix"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	glibc = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-glibc-2.39"
+	bash  = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-bash-5.2"
+)
+
+// fakeNixStore puts a nix-store on PATH whose --dump prints "nar:<path>" and whose
+// --import saves its stdin to the returned file.
+func fakeNixStore(t *testing.T) string {
+	dir := t.TempDir()
+	imported := filepath.Join(dir, "imported")
+	script := "#!/bin/sh\ncase \"$1\" in\n--dump) printf 'nar:%s' \"$2\" ;;\n--import) cat > " + imported + " ;;\n*) exit 1 ;;\nesac\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nix-store"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return imported
+}
+
+func pathInfo(path string, refs ...string) nix.PathInfo {
+	nar := []byte("nar:" + path)
+	sum := sha256.Sum256(nar)
+	return nix.PathInfo{Path: path, NarHash: nix.FormatSHA256(sum[:]), NarSize: int64(len(nar)), References: refs}
+}
+
+func testManifest() *Manifest {
+	return &Manifest{
+		Created: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Config:  "packages = [\"bash\"]\n",
+		Sum:     "0123abcd",
+		Env:     nix.ResolvedEnv{BashPath: bash + "/bin/bash", PATH: bash + "/bin"},
+		Paths:   []nix.PathInfo{pathInfo(glibc, glibc), pathInfo(bash, glibc)},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	imported := fakeNixStore(t)
+	key, err := nix.GenerateKey("test-1")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, testManifest(), key, nil))
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, testManifest().Paths, r.Manifest.Paths)
+	assert.Equal(t, nix.ClosureSum([]string{glibc, bash}), r.Manifest.ClosureSHA256)
+	assert.Equal(t, []string{glibc, bash}, r.Manifest.StorePaths())
+
+	signer, err := r.Verify([]*nix.PublicKey{key.Public()})
+	require.NoError(t, err)
+	assert.Equal(t, "test-1", signer.Name)
+	other, _ := nix.GenerateKey("other-1")
+	_, err = r.Verify([]*nix.PublicKey{other.Public()})
+	assert.ErrorContains(t, err, "signed by test-1")
+
+	require.NoError(t, r.Import())
+	stream, err := os.ReadFile(imported)
+	require.NoError(t, err)
+	// both NARs, dependencies first
+	i, j := bytes.Index(stream, []byte("nar:"+glibc)), bytes.Index(stream, []byte("nar:"+bash))
+	assert.True(t, i >= 0 && j > i, "export stream has the NARs in manifest order")
+}
+
+func TestUnsigned(t *testing.T) {
+	fakeNixStore(t)
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, testManifest(), nil, nil))
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	assert.Empty(t, r.Signatures)
+	_, err = r.Verify(nil)
+	assert.ErrorContains(t, err, "not signed")
+}
+
+func TestTamperedNAR(t *testing.T) {
+	fakeNixStore(t)
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, testManifest(), nil, nil))
+	// same size, different content: only the hash can tell
+	b := bytes.Replace(buf.Bytes(), []byte("nar:"+bash), []byte("nar:"+bash[:len(bash)-1]+"X"), 1)
+	r, err := NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.ErrorContains(t, r.Import(), bash+": hash mismatch")
+}
+
+func TestTamperedManifest(t *testing.T) {
+	fakeNixStore(t)
+	key, _ := nix.GenerateKey("test-1")
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, testManifest(), key, nil))
+	// still valid JSON and self-consistent, but no longer what was signed
+	b := bytes.Replace(buf.Bytes(), []byte(`"0123abcd"`), []byte(`"0123abce"`), 1)
+	r, err := NewReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	_, err = r.Verify([]*nix.PublicKey{key.Public()})
+	assert.ErrorContains(t, err, "doesn't match any trusted key")
+}
+
+func TestWriteErrors(t *testing.T) {
+	fakeNixStore(t)
+	tests := []struct {
+		name    string
+		modify  func(m *Manifest)
+		wantErr string
+	}{
+		{
+			name:    "no nar size",
+			modify:  func(m *Manifest) { m.Paths[0].NarSize = 0 },
+			wantErr: glibc + " has no NAR size",
+		},
+		{
+			name:    "registered hash differs",
+			modify:  func(m *Manifest) { m.Paths[1].NarHash = pathInfo(glibc).NarHash },
+			wantErr: bash + " doesn't match its registered hash",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testManifest()
+			tt.modify(m)
+			assert.ErrorContains(t, Write(&bytes.Buffer{}, m, nil, nil), tt.wantErr)
+		})
+	}
+}
+
+func TestManifestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(m *Manifest)
+		wantErr string
+	}{
+		{name: "valid", modify: func(m *Manifest) {}},
+		{name: "version", modify: func(m *Manifest) { m.Version = 2 }, wantErr: "bundle version 2 not supported"},
+		{name: "no sum", modify: func(m *Manifest) { m.Sum = "" }, wantErr: "incomplete"},
+		{name: "closure sum", modify: func(m *Manifest) { m.ClosureSHA256 = "00" }, wantErr: "closure_sha256"},
+		{
+			name:    "reference order",
+			modify:  func(m *Manifest) { m.Paths[0], m.Paths[1] = m.Paths[1], m.Paths[0] },
+			wantErr: "neither earlier in the bundle nor a prerequisite",
+		},
+		{
+			name: "prerequisite satisfies a reference",
+			modify: func(m *Manifest) {
+				m.Paths = m.Paths[1:]
+				m.Prerequisites = []string{glibc}
+				m.ClosureSHA256 = nix.ClosureSum(m.StorePaths())
+			},
+		},
+		{
+			name:    "bash outside the closure",
+			modify:  func(m *Manifest) { m.Env.BashPath = "/usr/bin/bash" },
+			wantErr: "not in its closure",
+		},
+		{
+			name:    "bad nar hash",
+			modify:  func(m *Manifest) { m.Paths[0].NarHash = "md5:x" },
+			wantErr: glibc,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testManifest()
+			m.Version = Version
+			m.ClosureSHA256 = nix.ClosureSum(m.StorePaths())
+			tt.modify(m)
+			err := m.check()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package bundle
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	plain := bytes.Repeat([]byte("lagoon bundle "), 1000)
+	for _, method := range []string{"", "none", "zstd", "gzip"} {
+		t.Run(method, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := Compress(&buf, method)
+			require.NoError(t, err)
+			_, err = w.Write(plain)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			r, err := Decompress(&buf)
+			require.NoError(t, err)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, plain, got)
+		})
+	}
+	_, err := Compress(io.Discard, "xz")
+	assert.ErrorContains(t, err, `unknown compression "xz"`)
+}
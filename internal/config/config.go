@@ -1,8 +1,10 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"regexp"
 
 	"github.com/BurntSushi/toml"
 )
@@ -17,12 +19,31 @@ const (
 
 // Config holds everything from lagoon.toml
 type Config struct {
-	Packages      []string          `toml:"packages"`
-	NixpkgsCommit string            `toml:"nixpkgs_commit"`
-	NixpkgsSHA256 string            `toml:"nixpkgs_sha256"`
-	Profile       string            `toml:"profile"`              // "minimal" or "network"
-	OnEnter       string            `toml:"on_enter,omitempty"`   // command to run on sandbox entry
-	Up            map[string]string `toml:"up,omitempty"`         // service name → shell command
+	Packages      []Package          `toml:"packages"`
+	NixpkgsCommit string             `toml:"nixpkgs_commit,omitempty"`
+	NixpkgsSHA256 string             `toml:"nixpkgs_sha256,omitempty"`
+	Nixpkgs       string             `toml:"nixpkgs,omitempty"`        // flake ref instead of the commit pin, or "flake.lock"
+	Flake         string             `toml:"flake,omitempty"`          // project devShell instead of packages, e.g. ".#default"
+	Python        *LangSet           `toml:"python,omitempty"`         // python.withPackages environment
+	Node          *LangSet           `toml:"node,omitempty"`           // nodejs plus CLI tools from nodePackages
+	R             *LangSet           `toml:"r,omitempty"`              // R with rPackages libraries
+	Perl          *LangSet           `toml:"perl,omitempty"`           // perl.withPackages environment
+	LocalPackages []string           `toml:"local_packages,omitempty"` // .nix files in the repo, built with callPackage
+	Overlays      []string           `toml:"overlays,omitempty"`       // nixpkgs overlay files, applied before packages are looked up
+	Substituters  []string           `toml:"substituters,omitempty"`   // extra binary caches to fetch from, e.g. one made by save --to-cache
+	TrustedKeys   []string           `toml:"trusted_keys,omitempty"`   // keys those caches' paths must be signed by
+	Profile       string             `toml:"profile"`                  // "minimal", "network" or "allowlist"
+	Allow         []string           `toml:"allow,omitempty"`          // host[:port] reachable under profile = "allowlist"
+	Ports         []string           `toml:"ports,omitempty"`          // sandbox ports published on the host, e.g. "8080:8080"
+	OnEnter       string             `toml:"on_enter,omitempty"`       // command to run on sandbox entry
+	Env           map[string]string  `toml:"env,omitempty"`            // variables set in every sandbox
+	EnvFiles      []string           `toml:"env_files,omitempty"`      // .env files read on every start, relative to the project
+	Passthrough   []string           `toml:"passthrough,omitempty"`    // host variables copied into the sandbox when set
+	Secrets       map[string]Secret  `toml:"secrets,omitempty"`        // files under /run/secrets, read from the host on every start
+	Up            map[string]Service `toml:"up,omitempty"`             // service name → service definition
+	Volumes       map[string]string  `toml:"volumes,omitempty"`        // sandbox path → named volume that persists it
+	Mounts        []Mount            `toml:"mounts,omitempty"`         // host directories bound into the sandbox
+	Limits        Limits             `toml:"limits,omitempty"`         // resource caps for every sandbox; flags override
 }
 
 // Read parses lagoon.toml from the given path
@@ -31,16 +52,80 @@ func Read(path string) (*Config, error) {
 	if _, err := toml.DecodeFile(path, &cfg); err != nil {
 		return nil, err
 	}
-	// catch typos early — nix-shell gives cryptic errors for bad hashes
-	if len(cfg.NixpkgsCommit) != 40 {
-		return nil, fmt.Errorf("nixpkgs_commit must be a 40-char git hash (got %d chars)", len(cfg.NixpkgsCommit))
+	if err := cfg.checkPin(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkPackages(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkLangs(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkEnv(); err != nil {
+		return nil, err
 	}
-	if len(cfg.NixpkgsSHA256) != 52 {
-		return nil, fmt.Errorf("nixpkgs_sha256 must be a 52-char nix hash (got %d chars)", len(cfg.NixpkgsSHA256))
+	if err := cfg.checkSecrets(); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkSubstituters(); err != nil {
+		return nil, err
 	}
 	return &cfg, nil
 }
 
+// checkPin makes sure exactly one way of pinning nixpkgs is used.
+func (c *Config) checkPin() error {
+	switch {
+	case c.Flake != "" && (c.Nixpkgs != "" || c.NixpkgsCommit != "" || len(c.Packages) > 0 || len(c.Langs()) > 0 || len(c.LocalPackages) > 0 || len(c.Overlays) > 0):
+		return fmt.Errorf("flake uses the devShell's own packages and pin — remove packages, language sections, local_packages, overlays, nixpkgs and nixpkgs_commit")
+	case c.Nixpkgs != "" && c.NixpkgsCommit != "":
+		return fmt.Errorf("set either nixpkgs (a flake ref) or nixpkgs_commit, not both")
+	case c.UsesFlakes():
+		return nil
+	}
+	// catch typos early — nix-shell gives cryptic errors for bad hashes
+	if len(c.NixpkgsCommit) != 40 {
+		return fmt.Errorf("nixpkgs_commit must be a 40-char git hash (got %d chars)", len(c.NixpkgsCommit))
+	}
+	if len(c.NixpkgsSHA256) != 52 {
+		return fmt.Errorf("nixpkgs_sha256 must be a 52-char nix hash (got %d chars)", len(c.NixpkgsSHA256))
+	}
+	return nil
+}
+
+// UsesFlakes reports whether the environment is resolved with nix develop
+// rather than a generated shell.nix.
+func (c *Config) UsesFlakes() bool {
+	return c.Nixpkgs != "" || c.Flake != ""
+}
+
+// pin lines in lagoon.toml — basic or literal TOML strings
+var (
+	commitLineRe = regexp.MustCompile(`(?m)^(\s*nixpkgs_commit\s*=\s*)("[^"]*"|'[^']*')`)
+	sha256LineRe = regexp.MustCompile(`(?m)^(\s*nixpkgs_sha256\s*=\s*)("[^"]*"|'[^']*')`)
+	tableLineRe  = regexp.MustCompile(`(?m)^\s*\[\[?\s*[A-Za-z0-9_.\-"' ]+\]\]?\s*(#.*)?$`)
+)
+
+// SetPin rewrites nixpkgs_commit and nixpkgs_sha256 in the file at path in place.
+// unlike Write, comments and layout survive.
+func SetPin(path, commit, sha256 string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// only the top-level table: [[packages]] entries carry pins of their own
+	top, rest := b, []byte(nil)
+	if loc := tableLineRe.FindIndex(b); loc != nil {
+		top, rest = b[:loc[0]], b[loc[0]:]
+	}
+	if !commitLineRe.Match(top) || !sha256LineRe.Match(top) {
+		return fmt.Errorf("%s has no nixpkgs_commit and nixpkgs_sha256 to update", path)
+	}
+	top = commitLineRe.ReplaceAll(top, []byte(`${1}"`+commit+`"`))
+	top = sha256LineRe.ReplaceAll(top, []byte(`${1}"`+sha256+`"`))
+	return os.WriteFile(path, append(top, rest...), 0644)
+}
+
 // Write encodes cfg to lagoon.toml at path
 func Write(path string, cfg *Config) error {
 	f, err := os.Create(path)
@@ -50,3 +135,15 @@ func Write(path string, cfg *Config) error {
 	defer f.Close()
 	return toml.NewEncoder(f).Encode(cfg)
 }
+
+// decodeTable fills dst from a table an UnmarshalTOML method was handed. it
+// round-trips through the encoder so dst's struct tags do the field mapping;
+// dst must be a type without UnmarshalTOML or decoding recurses.
+func decodeTable(v map[string]any, dst any) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	_, err := toml.Decode(buf.String(), dst)
+	return err
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPin(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "keeps comments and quoting style",
+			in:   "# pinned\nnixpkgs_commit = \"old\"  # bump with lagoon update\nnixpkgs_sha256 = 'oldsha'\nprofile = \"minimal\"\n",
+			want: "# pinned\nnixpkgs_commit = \"new\"  # bump with lagoon update\nnixpkgs_sha256 = \"newsha\"\nprofile = \"minimal\"\n",
+		},
+		{
+			name: "leaves per-package pins alone",
+			in: "nixpkgs_commit = \"old\"\nnixpkgs_sha256 = \"oldsha\"\n\n" +
+				"[[packages]]\nname = \"nodejs_18\"\nnixpkgs_commit = \"pkg\"\nnixpkgs_sha256 = \"pkgsha\"\n",
+			want: "nixpkgs_commit = \"new\"\nnixpkgs_sha256 = \"newsha\"\n\n" +
+				"[[packages]]\nname = \"nodejs_18\"\nnixpkgs_commit = \"pkg\"\nnixpkgs_sha256 = \"pkgsha\"\n",
+		},
+		{
+			name: "inline package pins stay too",
+			in:   "packages = [\n  { name = \"go\", nixpkgs_commit = \"pkg\", nixpkgs_sha256 = \"pkgsha\" },\n]\nnixpkgs_commit = \"old\"\nnixpkgs_sha256 = \"oldsha\"\n",
+			want: "packages = [\n  { name = \"go\", nixpkgs_commit = \"pkg\", nixpkgs_sha256 = \"pkgsha\" },\n]\nnixpkgs_commit = \"new\"\nnixpkgs_sha256 = \"newsha\"\n",
+		},
+		{
+			name:    "only inside a table",
+			in:      "profile = \"minimal\"\n\n[[packages]]\nname = \"go\"\nnixpkgs_commit = \"pkg\"\nnixpkgs_sha256 = \"pkgsha\"\n",
+			wantErr: "has no nixpkgs_commit and nixpkgs_sha256 to update",
+		},
+		{
+			name:    "flake project",
+			in:      "nixpkgs = \"github:NixOS/nixpkgs/nixos-unstable\"\n",
+			wantErr: "has no nixpkgs_commit and nixpkgs_sha256 to update",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), Filename)
+			require.NoError(t, os.WriteFile(path, []byte(tt.in), 0644))
+			err := SetPin(path, "new", "newsha")
+			got, _ := os.ReadFile(path)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Equal(t, tt.in, string(got), "file is untouched")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
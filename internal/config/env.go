@@ -0,0 +1,105 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// envNameRe matches the variable names a shell can export.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkEnv validates [env] and passthrough names. env files are read later,
+// relative to the project, so only their entries are checked here.
+func (c *Config) checkEnv() error {
+	for k := range c.Env {
+		if !envNameRe.MatchString(k) {
+			return fmt.Errorf("[env] %q is not a valid variable name", k)
+		}
+	}
+	for _, k := range c.Passthrough {
+		if !envNameRe.MatchString(k) {
+			return fmt.Errorf("passthrough %q is not a valid variable name", k)
+		}
+	}
+	for _, f := range c.EnvFiles {
+		if f == "" {
+			return fmt.Errorf("env_files has an empty entry")
+		}
+	}
+	return nil
+}
+
+// ReadEnvFile parses a .env file into KEY=VALUE pairs, in file order.
+// it takes what docker compose and dotenv agree on: blank lines and # comments,
+// an optional "export " prefix, and values that are bare, 'literal' or "quoted"
+// (the last with \n, \t, \" and \\ escapes). nothing is expanded.
+func ReadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var envs []string
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, val, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !envNameRe.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		val, err := envValue(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		envs = append(envs, key+"="+val)
+	}
+	return envs, s.Err()
+}
+
+// envValue unquotes one .env value. a bare value ends at " #", like a comment.
+func envValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, "'"):
+		end := strings.Index(v[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ' quote")
+		}
+		return v[1 : end+1], nil
+	case strings.HasPrefix(v, `"`):
+		var b strings.Builder
+		for i := 1; i < len(v); i++ {
+			switch v[i] {
+			case '"':
+				return b.String(), nil
+			case '\\':
+				if i+1 < len(v) {
+					i++
+					switch v[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(v[i])
+					}
+					continue
+				}
+			}
+			b.WriteByte(v[i])
+		}
+		return "", fmt.Errorf(`unterminated " quote`)
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v, nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "bare values",
+			content: "A=1\nB = two words\nEMPTY=\n",
+			want:    []string{"A=1", "B=two words", "EMPTY="},
+		},
+		{
+			name:    "comments and blank lines",
+			content: "# header\n\nA=1 # trailing\n  # indented\nB=x#y\n",
+			want:    []string{"A=1", "B=x#y"},
+		},
+		{
+			name:    "export prefix",
+			content: "export TOKEN=abc\n",
+			want:    []string{"TOKEN=abc"},
+		},
+		{
+			name:    "single quotes are literal",
+			content: `A='$HOME\n # not a comment'` + "\n",
+			want:    []string{`A=$HOME\n # not a comment`},
+		},
+		{
+			name:    "double quotes take escapes",
+			content: `A="line1\nline2\t\"q\" \\"` + "\n",
+			want:    []string{"A=line1\nline2\t\"q\" \\"},
+		},
+		{
+			name:    "nothing is expanded",
+			content: "A=${HOME}\n",
+			want:    []string{"A=${HOME}"},
+		},
+		{
+			name:    "file order, duplicates kept",
+			content: "B=1\nA=2\nB=3\n",
+			want:    []string{"B=1", "A=2", "B=3"},
+		},
+		{
+			name:    "missing equals",
+			content: "A=1\nJUSTAKEY\n",
+			wantErr: ":2: expected KEY=VALUE",
+		},
+		{
+			name:    "bad name",
+			content: "1A=x\n",
+			wantErr: ":1: expected KEY=VALUE",
+		},
+		{
+			name:    "unterminated single quote",
+			content: "A='open\n",
+			wantErr: ":1: unterminated ' quote",
+		},
+		{
+			name:    "unterminated double quote",
+			content: `A="open\"` + "\n",
+			wantErr: `:1: unterminated " quote`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".env")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+			got, err := ReadEnvFile(path)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReadEnvFileMissing(t *testing.T) {
+	_, err := ReadEnvFile(filepath.Join(t.TempDir(), "nope.env"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LangSet is an interpreter together with the libraries it should be able to import.
+// listing python311Packages.numpy as a top-level package gives a library no python
+// can see; a language section builds one environment with both:
+//
+//	[python]
+//	version = "311"
+//	packages = ["numpy", "pandas"]
+type LangSet struct {
+	Version  string   `toml:"version,omitempty"` // nixpkgs attr suffix, e.g. "311" for python311; empty = default
+	Packages []string `toml:"packages"`
+}
+
+// Lang is one configured language section.
+type Lang struct {
+	Name string // "python", "node", "r" or "perl"
+	*LangSet
+}
+
+var (
+	nixIdentRe    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+	langVersionRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+)
+
+// Langs returns the language sections that are set, in a fixed order.
+func (c *Config) Langs() []Lang {
+	var langs []Lang
+	for _, l := range []Lang{{"python", c.Python}, {"node", c.Node}, {"r", c.R}, {"perl", c.Perl}} {
+		if l.LangSet != nil {
+			langs = append(langs, l)
+		}
+	}
+	return langs
+}
+
+// Attr is the nixpkgs attribute of the interpreter, e.g. "python311" or "nodejs_20".
+// dots in the version are dropped, so "3.11" works as well as "311".
+func (l Lang) Attr() string {
+	v := strings.ReplaceAll(l.Version, ".", "")
+	switch l.Name {
+	case "python":
+		if v == "" {
+			return "python3"
+		}
+		return "python" + v
+	case "node":
+		if v == "" {
+			return "nodejs"
+		}
+		return "nodejs_" + v
+	case "r":
+		return "R"
+	}
+	return "perl" + v
+}
+
+// checkLangs validates every language section — names end up in generated nix.
+func (c *Config) checkLangs() error {
+	for _, l := range c.Langs() {
+		switch {
+		case l.Name == "r" && l.Version != "":
+			return fmt.Errorf("[r] takes no version — R comes from the pinned nixpkgs")
+		case l.Version != "" && !langVersionRe.MatchString(l.Version):
+			return fmt.Errorf("[%s] version %q must be digits, e.g. \"311\"", l.Name, l.Version)
+		}
+		for _, pkg := range l.Packages {
+			if !nixIdentRe.MatchString(pkg) {
+				return fmt.Errorf("[%s] package %q is not a valid package name", l.Name, pkg)
+			}
+		}
+	}
+	return nil
+}
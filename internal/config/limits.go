@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Limits caps what one sandbox may use, so a runaway build or fork bomb stays
+// inside its own sandbox on a shared machine:
+//
+//	[limits]
+//	memory = "2g"
+//	cpus = 1.5       # one and a half cores
+//	pids_max = 256
+//	io_weight = 50   # 1–10000, default 100
+type Limits struct {
+	Memory   string  `toml:"memory,omitempty"`    // MemoryMax, e.g. "512m", "1g"
+	CPUs     float64 `toml:"cpus,omitempty"`      // CPUQuota, in cores
+	PidsMax  int     `toml:"pids_max,omitempty"`  // TasksMax
+	IOWeight int     `toml:"io_weight,omitempty"` // IOWeight, relative to other sandboxes
+}
+
+// Set reports whether any limit is configured.
+func (l Limits) Set() bool {
+	return l.Memory != "" || l.CPUs != 0 || l.PidsMax != 0 || l.IOWeight != 0
+}
+
+// Merge returns l with every limit that's set in o replacing it.
+func (l Limits) Merge(o Limits) Limits {
+	if o.Memory != "" {
+		l.Memory = o.Memory
+	}
+	if o.CPUs != 0 {
+		l.CPUs = o.CPUs
+	}
+	if o.PidsMax != 0 {
+		l.PidsMax = o.PidsMax
+	}
+	if o.IOWeight != 0 {
+		l.IOWeight = o.IOWeight
+	}
+	return l
+}
+
+// Check validates every limit that's set.
+func (l Limits) Check() error {
+	if l.Memory != "" {
+		if _, err := l.MemoryBytes(); err != nil {
+			return err
+		}
+	}
+	if l.CPUs < 0 || (l.CPUs > 0 && l.CPUs < 0.01) {
+		return fmt.Errorf("cpus must be at least 0.01 (got %g)", l.CPUs)
+	}
+	if l.PidsMax < 0 {
+		return fmt.Errorf("pids_max must be positive (got %d)", l.PidsMax)
+	}
+	if l.IOWeight < 0 || l.IOWeight > 10000 {
+		return fmt.Errorf("io_weight must be between 1 and 10000 (got %d)", l.IOWeight)
+	}
+	return nil
+}
+
+// MemoryBytes parses Memory: a byte count with an optional k, m, g or t suffix (powers of 1024).
+func (l Limits) MemoryBytes() (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(l.Memory))
+	mult := int64(1)
+	if s != "" {
+		if i := strings.IndexByte("kmgt", s[len(s)-1]); i >= 0 {
+			mult = int64(1) << (10 * (i + 1))
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64/mult {
+		return 0, fmt.Errorf("memory %q: must be a size like 512m or 2g", l.Memory)
+	}
+	return n * mult, nil
+}
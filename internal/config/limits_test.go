@@ -0,0 +1,82 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBytes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1048576", want: 1 << 20},
+		{in: "512k", want: 512 << 10},
+		{in: "512m", want: 512 << 20},
+		{in: "512M", want: 512 << 20},
+		{in: "2g", want: 2 << 30},
+		{in: "1t", want: 1 << 40},
+		{in: " 1g ", want: 1 << 30},
+		{in: "0", wantErr: true},
+		{in: "0g", wantErr: true},
+		{in: "-1g", wantErr: true},
+		{in: "1.5g", wantErr: true},
+		{in: "1gb", wantErr: true},
+		{in: "1p", wantErr: true},
+		{in: "g", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "8388608t", wantErr: true}, // 2^63 bytes
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Limits{Memory: tt.in}.MemoryBytes()
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "must be a size like 512m or 2g")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		wantErr string
+	}{
+		{name: "unset", limits: Limits{}},
+		{name: "all set", limits: Limits{Memory: "2g", CPUs: 1.5, PidsMax: 256, IOWeight: 50}},
+		{name: "smallest", limits: Limits{CPUs: 0.01, PidsMax: 1, IOWeight: 1}},
+		{name: "largest io weight", limits: Limits{IOWeight: 10000}},
+		{name: "zero memory", limits: Limits{Memory: "0m"}, wantErr: `memory "0m"`},
+		{name: "negative memory", limits: Limits{Memory: "-512m"}, wantErr: `memory "-512m"`},
+		{name: "negative cpus", limits: Limits{CPUs: -1}, wantErr: "cpus must be at least 0.01 (got -1)"},
+		{name: "tiny cpus", limits: Limits{CPUs: 0.001}, wantErr: "cpus must be at least 0.01"},
+		{name: "negative pids", limits: Limits{PidsMax: -1}, wantErr: "pids_max must be positive"},
+		{name: "negative io weight", limits: Limits{IOWeight: -5}, wantErr: "io_weight must be between 1 and 10000"},
+		{name: "io weight too big", limits: Limits{IOWeight: 10001}, wantErr: "io_weight must be between 1 and 10000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.Check()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLimitsMerge(t *testing.T) {
+	file := Limits{Memory: "2g", CPUs: 2, PidsMax: 256}
+	got := file.Merge(Limits{Memory: "512m", IOWeight: 10})
+	assert.Equal(t, Limits{Memory: "512m", CPUs: 2, PidsMax: 256, IOWeight: 10}, got, "flags override, unset flags keep the file's value")
+	assert.False(t, Limits{}.Set())
+	assert.True(t, Limits{IOWeight: 1}.Set())
+}
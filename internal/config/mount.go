@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mount binds a host path into the sandbox.
+//
+//	[[mounts]]
+//	source = "../shared"
+//	target = "/shared"
+//	mode = "rw"
+type Mount struct {
+	Source string `toml:"source"`         // host path; relative paths are relative to the project dir
+	Target string `toml:"target"`         // sandbox path; "~/" is the sandbox home
+	Mode   string `toml:"mode,omitempty"` // "ro" (default) or "rw"
+}
+
+// ParseMount parses a --mount flag: source:target[:ro|rw].
+func ParseMount(spec string) (Mount, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Mount{}, fmt.Errorf("--mount %q: must be source:target[:ro|rw]", spec)
+	}
+	m := Mount{Source: parts[0], Target: parts[1]}
+	if len(parts) == 3 {
+		m.Mode = parts[2]
+	}
+	return m, m.Check()
+}
+
+// ReadOnly reports whether the mount is read-only. ro is the default.
+func (m Mount) ReadOnly() bool {
+	return m.Mode != "rw"
+}
+
+// Check validates everything about m that doesn't need the host filesystem.
+func (m Mount) Check() error {
+	if m.Source == "" {
+		return fmt.Errorf("mount → %q: source is empty", m.Target)
+	}
+	if m.Mode != "" && m.Mode != "ro" && m.Mode != "rw" {
+		return fmt.Errorf(`mount %q: mode must be "ro" or "rw"`, m.Source)
+	}
+	if err := CheckTarget(m.Target); err != nil {
+		return fmt.Errorf("mount %q: %w", m.Source, err)
+	}
+	return nil
+}
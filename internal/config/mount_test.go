@@ -0,0 +1,47 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMount(t *testing.T) {
+	tests := []struct {
+		spec     string
+		want     Mount
+		readOnly bool
+		wantErr  string
+	}{
+		{spec: "../shared:/shared", want: Mount{Source: "../shared", Target: "/shared"}, readOnly: true},
+		{spec: "data:/data:ro", want: Mount{Source: "data", Target: "/data", Mode: "ro"}, readOnly: true},
+		{spec: "data:/data:rw", want: Mount{Source: "data", Target: "/data", Mode: "rw"}},
+		{spec: "~/.aws:~/.aws", want: Mount{Source: "~/.aws", Target: "~/.aws"}, readOnly: true},
+		{spec: "data", wantErr: "must be source:target"},
+		{spec: ":/data", wantErr: "must be source:target"},
+		{spec: "data:", wantErr: "must be source:target"},
+		{spec: "a:/b:rw:x", wantErr: "must be source:target"},
+		{spec: "data:/data:rx", wantErr: `mode must be "ro" or "rw"`},
+		{spec: "data:relative", wantErr: "must be an absolute path"},
+		{spec: "data:/workspace/x", wantErr: "would shadow /workspace"},
+		{spec: "data:~/../../nix/store", wantErr: "must stay inside the home directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			m, err := ParseMount(tt.spec)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, m)
+			assert.Equal(t, tt.readOnly, m.ReadOnly())
+		})
+	}
+}
+
+func TestMountCheck(t *testing.T) {
+	assert.ErrorContains(t, Mount{Target: "/data"}.Check(), "source is empty")
+	assert.NoError(t, Mount{Source: "/srv", Target: "/srv", Mode: "rw"}.Check())
+}
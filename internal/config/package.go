@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Package is one entry in the packages list. a bare string takes the package from
+// the project's nixpkgs pin; a table pins that one package to another revision:
+//
+//	packages = [
+//	  "git",
+//	  { name = "nodejs_18", nixpkgs_commit = "...", nixpkgs_sha256 = "..." },
+//	]
+type Package struct {
+	Name          string `toml:"name"`
+	NixpkgsCommit string `toml:"nixpkgs_commit,omitempty"`
+	NixpkgsSHA256 string `toml:"nixpkgs_sha256,omitempty"`
+}
+
+// Packages turns plain names into entries that follow the project pin.
+func Packages(names ...string) []Package {
+	pkgs := make([]Package, len(names))
+	for i, n := range names {
+		pkgs[i] = Package{Name: n}
+	}
+	return pkgs
+}
+
+// Pinned reports whether the package comes from its own nixpkgs revision.
+func (p Package) Pinned() bool {
+	return p.NixpkgsCommit != ""
+}
+
+// UnmarshalTOML accepts either a package name or a table with its own pin.
+func (p *Package) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case string:
+		*p = Package{Name: v}
+		return nil
+	case map[string]any:
+		type plain Package // drops this method so decodeTable doesn't recurse
+		var pl plain
+		if err := decodeTable(v, &pl); err != nil {
+			return err
+		}
+		*p = Package(pl)
+		return nil
+	}
+	return fmt.Errorf("package must be a name or a table, got %T", v)
+}
+
+// MarshalTOML writes unpinned packages back as bare strings.
+func (p Package) MarshalTOML() ([]byte, error) {
+	if !p.Pinned() {
+		return []byte(strconv.Quote(p.Name)), nil
+	}
+	return fmt.Appendf(nil, "{ name = %q, nixpkgs_commit = %q, nixpkgs_sha256 = %q }",
+		p.Name, p.NixpkgsCommit, p.NixpkgsSHA256), nil
+}
+
+// check validates a pinned entry the same way Read validates the project pin.
+func (p Package) check() error {
+	if p.Name == "" {
+		return fmt.Errorf("package entry has no name")
+	}
+	if !p.Pinned() {
+		if p.NixpkgsSHA256 != "" {
+			return fmt.Errorf("package %q: nixpkgs_sha256 without nixpkgs_commit", p.Name)
+		}
+		return nil
+	}
+	if len(p.NixpkgsCommit) != 40 {
+		return fmt.Errorf("package %q: nixpkgs_commit must be a 40-char git hash (got %d chars)", p.Name, len(p.NixpkgsCommit))
+	}
+	if len(p.NixpkgsSHA256) != 52 {
+		return fmt.Errorf("package %q: nixpkgs_sha256 must be a 52-char nix hash (got %d chars)", p.Name, len(p.NixpkgsSHA256))
+	}
+	return nil
+}
+
+// checkPackages validates every entry, and that a revision pinned twice has one hash.
+func (c *Config) checkPackages() error {
+	hashes := map[string]string{}
+	for _, p := range c.Packages {
+		if err := p.check(); err != nil {
+			return err
+		}
+		if !p.Pinned() {
+			continue
+		}
+		if h, ok := hashes[p.NixpkgsCommit]; ok && h != p.NixpkgsSHA256 {
+			return fmt.Errorf("package %q: nixpkgs_commit %s is pinned elsewhere with a different nixpkgs_sha256", p.Name, p.NixpkgsCommit[:12])
+		}
+		hashes[p.NixpkgsCommit] = p.NixpkgsSHA256
+	}
+	return nil
+}
+
+// PackageNames returns the names of every entry in the packages list.
+func (c *Config) PackageNames() []string {
+	names := make([]string, len(c.Packages))
+	for i, p := range c.Packages {
+		names[i] = p.Name
+	}
+	return names
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Port publishes a port from a sandbox without network access on the host.
+type Port struct {
+	HostIP      string // defaults to 127.0.0.1 — only this machine can connect
+	HostPort    int
+	SandboxPort int
+}
+
+// ParsePort parses "8080", "8080:80" (host:sandbox) or "0.0.0.0:8080:80".
+func ParsePort(spec string) (Port, error) {
+	parts := strings.Split(spec, ":")
+	p := Port{HostIP: "127.0.0.1"}
+	var hostPort, sandboxPort string
+	switch len(parts) {
+	case 1:
+		hostPort, sandboxPort = parts[0], parts[0]
+	case 2:
+		hostPort, sandboxPort = parts[0], parts[1]
+	case 3:
+		p.HostIP, hostPort, sandboxPort = parts[0], parts[1], parts[2]
+		if net.ParseIP(p.HostIP) == nil {
+			return Port{}, fmt.Errorf("port %q: %q is not an IP address", spec, p.HostIP)
+		}
+	default:
+		return Port{}, fmt.Errorf("port %q: must be port, host:sandbox or ip:host:sandbox", spec)
+	}
+	var err error
+	if p.HostPort, err = parsePortNum(hostPort); err != nil {
+		return Port{}, fmt.Errorf("port %q: %w", spec, err)
+	}
+	if p.SandboxPort, err = parsePortNum(sandboxPort); err != nil {
+		return Port{}, fmt.Errorf("port %q: %w", spec, err)
+	}
+	return p, nil
+}
+
+// ParsePorts parses a ports list, rejecting the same host or sandbox port twice.
+func ParsePorts(specs []string) ([]Port, error) {
+	ports := make([]Port, 0, len(specs))
+	seen, inside := map[int]bool{}, map[int]bool{}
+	for _, s := range specs {
+		p, err := ParsePort(s)
+		if err != nil {
+			return nil, err
+		}
+		if seen[p.HostPort] {
+			return nil, fmt.Errorf("host port %d is published twice", p.HostPort)
+		}
+		if inside[p.SandboxPort] {
+			return nil, fmt.Errorf("sandbox port %d is published twice", p.SandboxPort)
+		}
+		seen[p.HostPort], inside[p.SandboxPort] = true, true
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+func parsePortNum(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("%q is not a port number", s)
+	}
+	return n, nil
+}
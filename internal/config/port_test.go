@@ -0,0 +1,64 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Port
+		wantErr string
+	}{
+		{spec: "8080", want: Port{HostIP: "127.0.0.1", HostPort: 8080, SandboxPort: 8080}},
+		{spec: "3000:80", want: Port{HostIP: "127.0.0.1", HostPort: 3000, SandboxPort: 80}},
+		{spec: "0.0.0.0:3000:80", want: Port{HostIP: "0.0.0.0", HostPort: 3000, SandboxPort: 80}},
+		{spec: "::1:3000:80", wantErr: "must be port, host:sandbox or ip:host:sandbox"},
+		{spec: "localhost:3000:80", wantErr: "is not an IP address"},
+		{spec: "", wantErr: "is not a port number"},
+		{spec: "http", wantErr: "is not a port number"},
+		{spec: "0", wantErr: "is not a port number"},
+		{spec: "65536", wantErr: "is not a port number"},
+		{spec: "8080:-1", wantErr: "is not a port number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			p, err := ParsePort(tt.spec)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, p)
+		})
+	}
+}
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    int
+		wantErr string
+	}{
+		{name: "none", specs: nil},
+		{name: "distinct", specs: []string{"8080", "3000:80"}, want: 2},
+		{name: "host twice", specs: []string{"8080:80", "8080:81"}, wantErr: "host port 8080 is published twice"},
+		{name: "sandbox twice", specs: []string{"8080:80", "8081:80"}, wantErr: "sandbox port 80 is published twice"},
+		{name: "bad entry", specs: []string{"8080", "x"}, wantErr: "is not a port number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ports, err := ParsePorts(tt.specs)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, ports, tt.want)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Secret says where a secret's value comes from — never the value itself.
+// each one is mounted read-only at /run/secrets/<name>:
+//
+//	[secrets]
+//	github_token = { command = "pass show github/token" }
+//	npmrc = { file = "~/.npmrc" }
+//	ci_token = { env = "CI_JOB_TOKEN" }
+//	db_password = { prompt = "database password" }
+type Secret struct {
+	File    string `toml:"file,omitempty"`    // host file; relative to the project, ~/ is your host home
+	Command string `toml:"command,omitempty"` // run on the host with sh -c; stdout is the secret
+	Env     string `toml:"env,omitempty"`     // variable in lagoon's own environment on the host
+	Prompt  string `toml:"prompt,omitempty"`  // asked for on every start, without echo
+	Plain   string `toml:"-"`                 // a value written straight into lagoon.toml — refused
+}
+
+// UnmarshalTOML keeps a bare string as Plain, so check can point at it instead
+// of the whole file failing to parse.
+func (s *Secret) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case string:
+		*s = Secret{Plain: v}
+		return nil
+	case map[string]any:
+		*s = Secret{}
+		for k, val := range v {
+			str, ok := val.(string)
+			if !ok {
+				return fmt.Errorf("secret field %q must be a string", k)
+			}
+			switch k {
+			case "file":
+				s.File = str
+			case "command":
+				s.Command = str
+			case "env":
+				s.Env = str
+			case "prompt":
+				s.Prompt = str
+			case "value":
+				s.Plain = str
+			default:
+				return fmt.Errorf("unknown secret field %q — use file, command, env or prompt", k)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("secret must be a table like { command = \"...\" }, got %T", v)
+}
+
+// secretNameRe matches names that are safe as a file under /run/secrets.
+var secretNameRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// checkSecrets validates [secrets] names and sources. plaintext values pass here —
+// lagoon check reports them, and no sandbox starts with one.
+func (c *Config) checkSecrets() error {
+	for name, s := range c.Secrets {
+		if !secretNameRe.MatchString(name) {
+			return fmt.Errorf("secret %q: name must be letters, digits, '_', '.' or '-'", name)
+		}
+		if s.Plain != "" {
+			continue
+		}
+		n := 0
+		for _, src := range []string{s.File, s.Command, s.Env, s.Prompt} {
+			if src != "" {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("secret %q: set exactly one of file, command, env or prompt", name)
+		}
+	}
+	return nil
+}
+
+// secretKeyRe matches variable names that usually hold credentials.
+var secretKeyRe = regexp.MustCompile(`(?i)(token|secret|passw(or)?d|api_?key|private_?key|credential)`)
+
+// secretValueRe matches well-known credential formats, whatever the variable is called.
+var secretValueRe = regexp.MustCompile(`^(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_\w{20,}|glpat-[\w-]{20,}|sk-[\w-]{20,}|xox[abprs]-[\w-]{10,}|(AKIA|ASIA)[A-Z0-9]{16})$|-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+
+// LooksSecret reports whether key=value looks like a credential written in plaintext.
+// short values and ${...} references pass, so "changeme" style dev defaults don't trip it.
+func LooksSecret(key, value string) bool {
+	if secretValueRe.MatchString(value) {
+		return true
+	}
+	return secretKeyRe.MatchString(key) && len(value) >= 16 && !strings.Contains(value, "${")
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Service is one entry in the [up] table.
+// a bare string is shorthand for a service with only cmd set:
+//
+//	[up]
+//	web = "node server.js"
+//
+//	[up.api]
+//	cmd = "python3 -m flask run --port 8080"
+//	depends_on = ["db"]
+//	ready = { http = "http://localhost:8080/health" }
+//	restart = "on-failure"
+//	ports = ["8080:8080"]
+type Service struct {
+	Cmd       string            `toml:"cmd"`
+	DependsOn []string          `toml:"depends_on,omitempty"` // services that must be ready first
+	Ready     Probe             `toml:"ready,omitempty"`
+	Restart   string            `toml:"restart,omitempty"` // "no" (default), "on-failure" or "always"
+	Env       map[string]string `toml:"env,omitempty"`     // extra env vars for this service only
+	Cwd       string            `toml:"cwd,omitempty"`     // working dir, relative to /workspace
+	Ports     []string          `toml:"ports,omitempty"`   // published ports; with these the service gets no other network
+}
+
+// Probe decides when a service is ready for its dependents. at most one check is set;
+// with none, a service counts as ready as soon as it has started.
+type Probe struct {
+	TCP     int    `toml:"tcp,omitempty"`     // localhost port accepts connections
+	HTTP    string `toml:"http,omitempty"`    // URL answers 200
+	Cmd     string `toml:"cmd,omitempty"`     // command exits 0 inside the sandbox
+	Timeout string `toml:"timeout,omitempty"` // give up after this long (default 60s)
+}
+
+// DefaultProbeTimeout is how long dependents wait for a probe that sets no timeout.
+const DefaultProbeTimeout = 60 * time.Second
+
+// UnmarshalTOML accepts either a command string or a full service table.
+func (s *Service) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case string:
+		*s = Service{Cmd: v}
+		return nil
+	case map[string]any:
+		type plain Service // drops this method so decodeTable doesn't recurse
+		var p plain
+		if err := decodeTable(v, &p); err != nil {
+			return err
+		}
+		*s = Service(p)
+		return nil
+	}
+	return fmt.Errorf("service must be a command string or a table, got %T", v)
+}
+
+// Set reports whether any readiness check is configured.
+func (p Probe) Set() bool {
+	return p.TCP != 0 || p.HTTP != "" || p.Cmd != ""
+}
+
+// TimeoutDuration parses Timeout, falling back to DefaultProbeTimeout.
+func (p Probe) TimeoutDuration() (time.Duration, error) {
+	if p.Timeout == "" {
+		return DefaultProbeTimeout, nil
+	}
+	return time.ParseDuration(p.Timeout)
+}
+
+// validate checks a single service definition in isolation.
+func (s Service) validate(name string, all map[string]Service) error {
+	if strings.TrimSpace(s.Cmd) == "" {
+		return fmt.Errorf("service %q: cmd is empty", name)
+	}
+	switch s.Restart {
+	case "", "no", "on-failure", "always":
+	default:
+		return fmt.Errorf(`service %q: restart must be "no", "on-failure" or "always"`, name)
+	}
+	checks := 0
+	for _, set := range []bool{s.Ready.TCP != 0, s.Ready.HTTP != "", s.Ready.Cmd != ""} {
+		if set {
+			checks++
+		}
+	}
+	if checks > 1 {
+		return fmt.Errorf("service %q: ready takes one of tcp, http or cmd", name)
+	}
+	if s.Ready.TCP < 0 || s.Ready.TCP > 65535 {
+		return fmt.Errorf("service %q: ready.tcp must be a port number", name)
+	}
+	if _, err := s.Ready.TimeoutDuration(); err != nil {
+		return fmt.Errorf("service %q: ready.timeout: %w", name, err)
+	}
+	if _, err := ParsePorts(s.Ports); err != nil {
+		return fmt.Errorf("service %q: %w", name, err)
+	}
+	if s.Cwd != "" {
+		// joined onto /workspace, so it must name somewhere inside it
+		if clean := path.Clean(s.Cwd); path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("service %q: cwd %q must be a path inside the project", name, s.Cwd)
+		}
+	}
+	for _, dep := range s.DependsOn {
+		if _, ok := all[dep]; !ok {
+			return fmt.Errorf("service %q depends on unknown service %q", name, dep)
+		}
+	}
+	return nil
+}
+
+// ServiceOrder validates the [up] table and returns service names in start order:
+// every service comes after everything it depends on, ties broken alphabetically.
+func (c *Config) ServiceOrder() ([]string, error) {
+	names := make([]string, 0, len(c.Up))
+	for n, svc := range c.Up {
+		if err := svc.validate(n, c.Up); err != nil {
+			return nil, err
+		}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	// every service binds its host ports in the same host network namespace
+	owner := map[int]string{}
+	for _, n := range names {
+		ports, _ := ParsePorts(c.Up[n].Ports) // validated above
+		for _, p := range ports {
+			if other, ok := owner[p.HostPort]; ok {
+				return nil, fmt.Errorf("services %q and %q both publish host port %d", other, n, p.HostPort)
+			}
+			owner[p.HostPort] = n
+		}
+	}
+
+	// depth-first topological sort — "visiting" marks the current path to catch cycles
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	order := make([]string, 0, len(names))
+	var visit func(n string, path []string) error
+	visit = func(n string, path []string) error {
+		switch state[n] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("services depend on each other in a cycle: %s", strings.Join(append(path, n), " → "))
+		}
+		state[n] = visiting
+		deps := append([]string(nil), c.Up[n].DependsOn...)
+		sort.Strings(deps)
+		for _, d := range deps {
+			if err := visit(d, append(path, n)); err != nil {
+				return err
+			}
+		}
+		state[n] = done
+		order = append(order, n)
+		return nil
+	}
+	for _, n := range names {
+		if err := visit(n, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		up      map[string]Service
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "alphabetical without deps",
+			up:   map[string]Service{"web": {Cmd: "a"}, "api": {Cmd: "b"}, "db": {Cmd: "c"}},
+			want: []string{"api", "db", "web"},
+		},
+		{
+			name: "deps come first",
+			up: map[string]Service{
+				"web": {Cmd: "a", DependsOn: []string{"api"}},
+				"api": {Cmd: "b", DependsOn: []string{"db"}},
+				"db":  {Cmd: "c"},
+			},
+			want: []string{"db", "api", "web"},
+		},
+		{
+			name: "cycle",
+			up: map[string]Service{
+				"a": {Cmd: "a", DependsOn: []string{"b"}},
+				"b": {Cmd: "b", DependsOn: []string{"a"}},
+			},
+			wantErr: "cycle: a → b → a",
+		},
+		{
+			name:    "unknown dep",
+			up:      map[string]Service{"web": {Cmd: "a", DependsOn: []string{"db"}}},
+			wantErr: `depends on unknown service "db"`,
+		},
+		{
+			name:    "empty cmd",
+			up:      map[string]Service{"web": {Cmd: " "}},
+			wantErr: "cmd is empty",
+		},
+		{
+			name:    "bad restart",
+			up:      map[string]Service{"web": {Cmd: "a", Restart: "sometimes"}},
+			wantErr: "restart must be",
+		},
+		{
+			name:    "two probes",
+			up:      map[string]Service{"web": {Cmd: "a", Ready: Probe{TCP: 80, HTTP: "http://localhost"}}},
+			wantErr: "ready takes one of",
+		},
+		{
+			name:    "bad timeout",
+			up:      map[string]Service{"web": {Cmd: "a", Ready: Probe{TCP: 80, Timeout: "soon"}}},
+			wantErr: "ready.timeout",
+		},
+		{
+			name: "same host port",
+			up: map[string]Service{
+				"a": {Cmd: "a", Ports: []string{"8080"}},
+				"b": {Cmd: "b", Ports: []string{"8080:80"}},
+			},
+			wantErr: "both publish host port 8080",
+		},
+		{
+			name: "relative cwd",
+			up:   map[string]Service{"web": {Cmd: "a", Cwd: "frontend/./app"}},
+			want: []string{"web"},
+		},
+		{
+			name:    "absolute cwd",
+			up:      map[string]Service{"web": {Cmd: "a", Cwd: "/etc"}},
+			wantErr: "must be a path inside the project",
+		},
+		{
+			name:    "cwd escapes",
+			up:      map[string]Service{"web": {Cmd: "a", Cwd: "app/../../etc"}},
+			wantErr: "must be a path inside the project",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Up: tt.up}
+			got, err := cfg.ServiceOrder()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServiceUnmarshal(t *testing.T) {
+	var cfg struct {
+		Up map[string]Service `toml:"up"`
+	}
+	_, err := toml.Decode(`
+[up]
+web = "node server.js"
+
+[up.api]
+cmd = "flask run"
+depends_on = ["web"]
+ready = { http = "http://localhost:8080/health" }
+`, &cfg)
+	require.NoError(t, err)
+	assert.Equal(t, Service{Cmd: "node server.js"}, cfg.Up["web"])
+	assert.Equal(t, Service{
+		Cmd:       "flask run",
+		DependsOn: []string{"web"},
+		Ready:     Probe{HTTP: "http://localhost:8080/health"},
+	}, cfg.Up["api"])
+}
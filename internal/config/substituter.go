@@ -0,0 +1,41 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// checkSubstituters validates extra binary caches and the keys trusted to sign them.
+func (c *Config) checkSubstituters() error {
+	for _, s := range c.Substituters {
+		if s == "" {
+			return fmt.Errorf("substituters has an empty entry")
+		}
+	}
+	for _, k := range c.TrustedKeys {
+		name, data, found := strings.Cut(k, ":")
+		b, err := base64.StdEncoding.DecodeString(data)
+		if !found || name == "" || err != nil || len(b) != 32 {
+			return fmt.Errorf("trusted_keys %q: must be name:base64, as printed by 'lagoon keys list'", k)
+		}
+	}
+	return nil
+}
+
+// SubstituterURLs returns substituters as nix URLs. an entry without a scheme is a
+// binary cache directory, relative to projectDir.
+func (c *Config) SubstituterURLs(projectDir string) []string {
+	urls := make([]string, len(c.Substituters))
+	for i, s := range c.Substituters {
+		if !strings.Contains(s, "://") {
+			if !filepath.IsAbs(s) {
+				s = filepath.Join(projectDir, s)
+			}
+			s = "file://" + s
+		}
+		urls[i] = s
+	}
+	return urls
+}
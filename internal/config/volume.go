@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// volumeNameRe keeps volume names safe to use as a directory name.
+var volumeNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// reservedTargets are sandbox paths lagoon mounts itself. a mount on, above or
+// inside one of them would hide the packages or the project.
+var reservedTargets = []string{"/nix/store", "/workspace"}
+
+// CheckVolumeName rejects names that aren't safe as a directory name.
+func CheckVolumeName(name string) error {
+	if !volumeNameRe.MatchString(name) {
+		return fmt.Errorf("volume %q: names may only contain letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// CheckVolume validates one [volumes] entry.
+func CheckVolume(target, name string) error {
+	if err := CheckVolumeName(name); err != nil {
+		return err
+	}
+	if err := CheckTarget(target); err != nil {
+		return fmt.Errorf("volume %q: %w", name, err)
+	}
+	return nil
+}
+
+// CheckTarget validates a sandbox mount point. "~/" is the sandbox home directory,
+// and a target may not climb out of it with "..".
+func CheckTarget(target string) error {
+	clean := path.Clean(target)
+	if rest, ok := strings.CutPrefix(target, "~/"); ok {
+		rel := path.Clean(rest)
+		if rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("target %q must stay inside the home directory", target)
+		}
+		clean = path.Join("/home", rel)
+	} else if !path.IsAbs(target) {
+		return fmt.Errorf("target %q must be an absolute path or start with ~/", target)
+	}
+	for _, r := range reservedTargets {
+		if clean == "/" || clean == r || strings.HasPrefix(r, clean+"/") || strings.HasPrefix(clean, r+"/") {
+			return fmt.Errorf("target %q would shadow %s", target, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		wantErr string
+	}{
+		{target: "/data"},
+		{target: "/var/lib/postgres"},
+		{target: "~/.cache"},
+		{target: "~/"},
+		{target: "~/a/../b"},
+		{target: "/workspacefoo"},
+		{target: "data", wantErr: "must be an absolute path or start with ~/"},
+		{target: "~data", wantErr: "must be an absolute path or start with ~/"},
+		{target: "/", wantErr: "would shadow"},
+		{target: "/nix", wantErr: "would shadow /nix/store"},
+		{target: "/nix/store", wantErr: "would shadow /nix/store"},
+		{target: "/nix/store/abc", wantErr: "would shadow /nix/store"},
+		{target: "/workspace/", wantErr: "would shadow /workspace"},
+		{target: "/workspace/node_modules", wantErr: "would shadow /workspace"},
+		{target: "/tmp/../workspace", wantErr: "would shadow /workspace"},
+		{target: "~/..", wantErr: "must stay inside the home directory"},
+		{target: "~/../../nix/store", wantErr: "must stay inside the home directory"},
+		{target: "~/a/../../workspace", wantErr: "must stay inside the home directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			err := CheckTarget(tt.target)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckVolumeName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"pgdata":   true,
+		"cache-v2": true,
+		"a.b_c":    true,
+		"":         false,
+		".hidden":  false,
+		"a/b":      false,
+		"..":       false,
+	} {
+		err := CheckVolumeName(name)
+		assert.Equal(t, valid, err == nil, "%q: %v", name, err)
+	}
+}
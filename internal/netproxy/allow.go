@@ -0,0 +1,58 @@
+// Package netproxy carries sandbox traffic across the network namespace boundary:
+// a filtering HTTP proxy for the "allowlist" profile and plain stream forwarding
+// for published ports.
+package netproxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// rule is one allow entry. an empty port matches any port; a host starting
+// with "*." matches every subdomain (but not the bare domain).
+type rule struct {
+	host string
+	port string
+}
+
+// Allowlist decides which host:port pairs the proxy will connect to.
+type Allowlist []rule
+
+// ParseAllowlist parses entries like "pypi.org:443", "git.internal" or "*.githubusercontent.com:443".
+func ParseAllowlist(entries []string) (Allowlist, error) {
+	var al Allowlist
+	for _, e := range entries {
+		host, port := strings.Trim(e, "[]"), "" // "[::1]" is an IPv6 host on any port
+		if h, p, err := net.SplitHostPort(e); err == nil {
+			host, port = h, p
+			if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+				return nil, fmt.Errorf("allow %q: bad port", e)
+			}
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if host == "" || strings.ContainsAny(host, "/ ") || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return nil, fmt.Errorf("allow %q: must be host, host:port or *.domain[:port]", e)
+		}
+		al = append(al, rule{host: host, port: port})
+	}
+	return al, nil
+}
+
+// Allowed reports whether a connection to host:port is permitted.
+func (al Allowlist) Allowed(host, port string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, r := range al {
+		if r.port != "" && r.port != port {
+			continue
+		}
+		if r.host == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(r.host, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package netproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAllowlist(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    rule
+		wantErr string
+	}{
+		{in: "pypi.org:443", want: rule{host: "pypi.org", port: "443"}},
+		{in: "git.internal", want: rule{host: "git.internal"}},
+		{in: "*.githubusercontent.com:443", want: rule{host: "*.githubusercontent.com", port: "443"}},
+		{in: "PyPI.Org.", want: rule{host: "pypi.org"}},
+		{in: "[::1]:8080", want: rule{host: "::1", port: "8080"}},
+		{in: "[::1]", want: rule{host: "::1"}},
+		{in: "::1", want: rule{host: "::1"}},
+		{in: "", wantErr: "must be host"},
+		{in: "*", wantErr: "must be host"},
+		{in: "*.", wantErr: "must be host"},
+		{in: "*.*.example.com", wantErr: "must be host"},
+		{in: "a*.example.com", wantErr: "must be host"},
+		{in: "bad host", wantErr: "must be host"},
+		{in: "pypi.org:", wantErr: "bad port"},
+		{in: "pypi.org:0", wantErr: "bad port"},
+		{in: "pypi.org:65536", wantErr: "bad port"},
+		{in: "pypi.org:https", wantErr: "bad port"},
+		{in: "https://pypi.org", wantErr: "bad port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			al, err := ParseAllowlist([]string{tt.in})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, Allowlist{tt.want}, al)
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	al, err := ParseAllowlist([]string{
+		"pypi.org:443",
+		"git.internal",
+		"*.githubusercontent.com:443",
+		"*.example.com",
+		"[::1]:8080",
+		"[fe80::1]",
+	})
+	require.NoError(t, err)
+	tests := []struct {
+		host string
+		port string
+		want bool
+	}{
+		{host: "pypi.org", port: "443", want: true},
+		{host: "pypi.org", port: "80"},
+		{host: "files.pypi.org", port: "443"},
+		{host: "git.internal", port: "22", want: true},
+		{host: "git.internal", port: "443", want: true},
+		{host: "raw.githubusercontent.com", port: "443", want: true},
+		{host: "a.b.githubusercontent.com", port: "443", want: true},
+		{host: "raw.githubusercontent.com", port: "80"},
+		{host: "githubusercontent.com", port: "443"},
+		{host: "evilgithubusercontent.com", port: "443"},
+		{host: "example.com", port: "443"},
+		{host: "www.example.com", port: "1234", want: true},
+		{host: "PyPI.ORG", port: "443", want: true},
+		{host: "pypi.org.", port: "443", want: true},
+		{host: "raw.githubusercontent.com.", port: "443", want: true},
+		{host: "::1", port: "8080", want: true},
+		{host: "::1", port: "80"},
+		{host: "fe80::1", port: "443", want: true},
+		{host: "FE80::1", port: "443", want: true},
+		{host: "pypi.org.evil.com", port: "443"},
+		{host: "", port: "443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host+" "+tt.port, func(t *testing.T) {
+			assert.Equal(t, tt.want, al.Allowed(tt.host, tt.port))
+		})
+	}
+	assert.False(t, Allowlist(nil).Allowed("pypi.org", "443"), "an empty list allows nothing")
+}
@@ -0,0 +1,48 @@
+package netproxy
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// Forward accepts connections on ln and splices each one to a fresh connection
+// from dial. it returns when ln is closed.
+func Forward(ln net.Listener, dial func() (net.Conn, error)) error {
+	for {
+		src, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			dst, err := dial()
+			if err != nil {
+				src.Close()
+				return
+			}
+			Splice(src, dst)
+		}()
+	}
+}
+
+// Splice copies both ways between a and b until both directions are done,
+// then closes them. half-closes are passed on so request/response protocols finish cleanly.
+func Splice(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); pipe(a, b) }()
+	go func() { defer wg.Done(); pipe(b, a) }()
+	wg.Wait()
+	a.Close()
+	b.Close()
+}
+
+// pipe copies src to dst, then signals EOF to dst if it supports half-close.
+func pipe(dst, src net.Conn) {
+	io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
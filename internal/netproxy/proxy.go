@@ -0,0 +1,114 @@
+package netproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const dialTimeout = 10 * time.Second
+
+// Proxy is an HTTP proxy that only connects to allowlisted destinations.
+// HTTPS and anything else tunnelled via CONNECT is checked by host:port;
+// plain HTTP requests are checked by the host and port of their URL.
+type Proxy struct {
+	Allow Allowlist
+	// Denied, if set, is called for every refused destination so the user can see what was blocked
+	Denied func(hostport string)
+
+	transport *http.Transport
+}
+
+// Serve accepts proxy connections on ln until it is closed.
+func (p *Proxy) Serve(ln net.Listener) error {
+	p.transport = &http.Transport{Proxy: nil, DialContext: (&net.Dialer{Timeout: dialTimeout}).DialContext}
+	return http.Serve(ln, p)
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.connect(w, r)
+		return
+	}
+	if r.URL.Host == "" {
+		http.Error(w, "lagoon proxy: only proxy requests are accepted", http.StatusBadRequest)
+		return
+	}
+	if !p.permit(r.URL.Host, defaultPort(r.URL.Scheme)) {
+		http.Error(w, "lagoon: "+r.URL.Host+" is not in the allow list", http.StatusForbidden)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Connection")
+	out.Header.Del("Proxy-Authorization")
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, "lagoon proxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// connect handles CONNECT host:port by splicing the client to the destination.
+func (p *Proxy) connect(w http.ResponseWriter, r *http.Request) {
+	if !p.permit(r.Host, "443") {
+		http.Error(w, "lagoon: "+r.Host+" is not in the allow list", http.StatusForbidden)
+		return
+	}
+	dst, err := net.DialTimeout("tcp", r.Host, dialTimeout)
+	if err != nil {
+		http.Error(w, "lagoon proxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		dst.Close()
+		http.Error(w, "lagoon proxy: hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	src, buf, err := hj.Hijack()
+	if err != nil {
+		dst.Close()
+		return
+	}
+	src.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	// the client may have pipelined bytes (e.g. a TLS hello) behind the CONNECT
+	if n := buf.Reader.Buffered(); n > 0 {
+		b, _ := buf.Reader.Peek(n)
+		dst.Write(b)
+	}
+	Splice(src, dst)
+}
+
+// permit checks hostport against the allowlist, filling in defPort when it has none.
+func (p *Proxy) permit(hostport, defPort string) bool {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = strings.Trim(hostport, "[]"), defPort
+	}
+	if p.Allow.Allowed(host, port) {
+		return true
+	}
+	if p.Denied != nil {
+		p.Denied(net.JoinHostPort(host, port))
+	}
+	return false
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
@@ -0,0 +1,136 @@
+package netproxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startProxy serves a proxy allowing entries and returns its address and what it refused.
+func startProxy(t *testing.T, entries ...string) (string, *[]string) {
+	al, err := ParseAllowlist(entries)
+	require.NoError(t, err)
+	var denied []string
+	p := &Proxy{Allow: al, Denied: func(hostport string) { denied = append(denied, hostport) }}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go p.Serve(ln)
+	return ln.Addr().String(), &denied
+}
+
+func TestConnect(t *testing.T) {
+	dest, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer dest.Close()
+	_, port, _ := net.SplitHostPort(dest.Addr().String())
+
+	tests := []struct {
+		name  string
+		allow string
+		want  int
+	}{
+		{name: "allowed", allow: "127.0.0.1:" + port, want: http.StatusOK},
+		{name: "other port", allow: "127.0.0.1:1", want: http.StatusForbidden},
+		{name: "other host", allow: "localhost", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, denied := startProxy(t, tt.allow)
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				if c, err := dest.Accept(); err == nil {
+					accepted <- c
+				}
+			}()
+
+			c, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer c.Close()
+			_, err = io.WriteString(c, "CONNECT "+dest.Addr().String()+" HTTP/1.1\r\nHost: "+dest.Addr().String()+"\r\n\r\n")
+			require.NoError(t, err)
+			r := bufio.NewReader(c)
+			resp, err := http.ReadResponse(r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, resp.StatusCode)
+
+			if tt.want != http.StatusOK {
+				assert.Equal(t, []string{dest.Addr().String()}, *denied)
+				select {
+				case conn := <-accepted:
+					conn.Close()
+					t.Fatal("a refused CONNECT reached its destination")
+				case <-time.After(100 * time.Millisecond):
+				}
+				// wake the pending Accept so the next case starts clean
+				net.Dial("tcp", dest.Addr().String())
+				(<-accepted).Close()
+				return
+			}
+
+			// the tunnel carries bytes both ways
+			conn := <-accepted
+			defer conn.Close()
+			_, err = io.WriteString(c, "ping")
+			require.NoError(t, err)
+			buf := make([]byte, 4)
+			_, err = io.ReadFull(conn, buf)
+			require.NoError(t, err)
+			assert.Equal(t, "ping", string(buf))
+			_, err = io.WriteString(conn, "pong")
+			require.NoError(t, err)
+			_, err = io.ReadFull(r, buf)
+			require.NoError(t, err)
+			assert.Equal(t, "pong", string(buf))
+			assert.Empty(t, *denied)
+		})
+	}
+}
+
+func TestPlainHTTP(t *testing.T) {
+	hits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		assert.Empty(t, r.Header.Get("Proxy-Authorization"), "proxy credentials aren't passed on")
+		io.WriteString(w, "hello")
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	tests := []struct {
+		name  string
+		allow string
+		want  int
+		body  string
+	}{
+		{name: "allowed", allow: u.Host, want: http.StatusOK, body: "hello"},
+		{name: "refused", allow: u.Hostname() + ":1", want: http.StatusForbidden, body: "lagoon: " + u.Host + " is not in the allow list\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits = 0
+			addr, _ := startProxy(t, tt.allow)
+			client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: addr})}}
+			req, err := http.NewRequest(http.MethodGet, upstream.URL, nil)
+			require.NoError(t, err)
+			req.Header.Set("Proxy-Authorization", "Basic secret")
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.want, resp.StatusCode)
+			assert.Equal(t, tt.body, string(body))
+			if tt.want != http.StatusOK {
+				assert.Zero(t, hits, "a refused request never reaches the server")
+			}
+		})
+	}
+}
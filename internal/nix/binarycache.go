@@ -0,0 +1,122 @@
+package nix
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// cacheInfo marks a directory as a binary cache. a lower priority than
+// cache.nixos.org's 40 makes nix try it first.
+const cacheInfo = "StoreDir: /nix/store\nWantMassQuery: 1\nPriority: 30\n"
+
+// InitBinaryCache creates a binary cache directory nix can use as file://dir,
+// or over http from any static file server.
+func InitBinaryCache(dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "nar"), 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "nix-cache-info")
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return WriteAtomic(path, []byte(cacheInfo), 0644)
+}
+
+// Fingerprint is what nix signs for a store path: its name, NAR hash and size,
+// and full references.
+func Fingerprint(info PathInfo) string {
+	return fmt.Sprintf("1;%s;%s;%d;%s", info.Path, info.NarHash, info.NarSize, strings.Join(info.References, ","))
+}
+
+// AddToBinaryCache writes info's NAR under dir/nar and its .narinfo next to
+// nix-cache-info. compression is "none" or "zstd"; key, if set, signs the narinfo.
+// a path the cache already has is left alone and reported as not added.
+func AddToBinaryCache(dir string, info PathInfo, compression string, key *SecretKey, progress io.Writer) (bool, error) {
+	hashPart, _, _ := strings.Cut(filepath.Base(info.Path), "-")
+	narinfo := filepath.Join(dir, hashPart+".narinfo")
+	if _, err := os.Stat(narinfo); err == nil {
+		return false, nil
+	}
+	if progress == nil {
+		progress = io.Discard
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(dir, "nar"), ".nar-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name()) // renamed away on success
+	fileHash := sha256.New()
+	var out io.WriteCloser = nopWriteCloser{io.MultiWriter(tmp, fileHash)}
+	ext := ".nar"
+	switch compression {
+	case "zstd":
+		if out, err = zstd.NewWriter(out); err != nil {
+			tmp.Close()
+			return false, err
+		}
+		ext += ".zst"
+	case "", "none":
+		compression = "none"
+	default:
+		tmp.Close()
+		return false, fmt.Errorf("binary caches support zstd or no compression, not %q", compression)
+	}
+	narHash := sha256.New()
+	err = DumpPath(info.Path, io.MultiWriter(out, narHash, progress))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+	if FormatSHA256(narHash.Sum(nil)) != info.NarHash {
+		return false, fmt.Errorf("%s doesn't match its registered hash — run 'nix-store --verify --check-contents'", info.Path)
+	}
+	st, err := os.Stat(tmp.Name())
+	if err != nil {
+		return false, err
+	}
+	url := "nar/" + Nix32(fileHash.Sum(nil)) + ext
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, url)); err != nil {
+		return false, err
+	}
+
+	// the narinfo goes last: nix only sees the path once its NAR is in place
+	var b strings.Builder
+	fmt.Fprintf(&b, "StorePath: %s\n", info.Path)
+	fmt.Fprintf(&b, "URL: %s\n", url)
+	fmt.Fprintf(&b, "Compression: %s\n", compression)
+	fmt.Fprintf(&b, "FileHash: %s\n", FormatSHA256(fileHash.Sum(nil)))
+	fmt.Fprintf(&b, "FileSize: %d\n", st.Size())
+	fmt.Fprintf(&b, "NarHash: %s\n", info.NarHash)
+	fmt.Fprintf(&b, "NarSize: %d\n", info.NarSize)
+	refs := make([]string, len(info.References))
+	for i, r := range info.References {
+		refs[i] = filepath.Base(r)
+	}
+	fmt.Fprintf(&b, "References: %s\n", strings.Join(refs, " "))
+	if info.Deriver != "" {
+		fmt.Fprintf(&b, "Deriver: %s\n", filepath.Base(info.Deriver))
+	}
+	if key != nil {
+		fmt.Fprintf(&b, "Sig: %s\n", key.Sign([]byte(Fingerprint(info))))
+	}
+	return true, WriteAtomic(narinfo, []byte(b.String()), 0644)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,145 @@
+package nix
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDump puts a nix-store on PATH whose --dump prints "nar:<path>".
+func fakeDump(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = --dump ] || exit 1\nprintf 'nar:%s' \"$2\"\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nix-store"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func fakeInfo(path string, refs ...string) PathInfo {
+	nar := []byte("nar:" + path)
+	sum := sha256.Sum256(nar)
+	return PathInfo{Path: path, NarHash: FormatSHA256(sum[:]), NarSize: int64(len(nar)), References: refs, Deriver: helloDrv}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		name string
+		info PathInfo
+		want string
+	}{
+		{
+			name: "no references",
+			info: PathInfo{Path: glibc, NarHash: emptyNix, NarSize: 99},
+			want: "1;" + glibc + ";" + emptyNix + ";99;",
+		},
+		{
+			// full paths, comma separated, self-reference included — as nix signs them
+			name: "references",
+			info: PathInfo{Path: hello, NarHash: emptyNix, NarSize: 1234, References: []string{glibc, hello}, Deriver: helloDrv},
+			want: "1;" + hello + ";" + emptyNix + ";1234;" + glibc + "," + hello,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Fingerprint(tt.info))
+		})
+	}
+}
+
+// narinfo parses a .narinfo into its fields.
+func narinfo(t *testing.T, path string) map[string]string {
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	fields := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		k, v, found := strings.Cut(line, ": ")
+		require.True(t, found, line)
+		fields[k] = v
+	}
+	return fields
+}
+
+func TestAddToBinaryCache(t *testing.T) {
+	fakeDump(t)
+	key, err := GenerateKey("cache-1")
+	require.NoError(t, err)
+	info := fakeInfo(hello, glibc, hello)
+
+	for _, compression := range []string{"none", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, InitBinaryCache(dir))
+			cacheInfo, err := os.ReadFile(filepath.Join(dir, "nix-cache-info"))
+			require.NoError(t, err)
+			assert.Contains(t, string(cacheInfo), "StoreDir: /nix/store\n")
+
+			added, err := AddToBinaryCache(dir, info, compression, key, nil)
+			require.NoError(t, err)
+			assert.True(t, added)
+
+			fields := narinfo(t, filepath.Join(dir, "cccccccccccccccccccccccccccccccc.narinfo"))
+			assert.Equal(t, hello, fields["StorePath"])
+			assert.Equal(t, compression, fields["Compression"])
+			assert.Equal(t, info.NarHash, fields["NarHash"])
+			assert.Equal(t, strconv.FormatInt(info.NarSize, 10), fields["NarSize"])
+			assert.Equal(t, filepath.Base(glibc)+" "+filepath.Base(hello), fields["References"])
+			assert.Equal(t, filepath.Base(helloDrv), fields["Deriver"])
+			assert.True(t, key.Public().Verify([]byte(Fingerprint(info)), fields["Sig"]), "Sig covers the fingerprint")
+
+			// the file is named and hashed as nix will fetch it
+			file, err := os.ReadFile(filepath.Join(dir, fields["URL"]))
+			require.NoError(t, err)
+			fileHash := sha256.Sum256(file)
+			assert.Equal(t, FormatSHA256(fileHash[:]), fields["FileHash"])
+			assert.Equal(t, strconv.Itoa(len(file)), fields["FileSize"])
+			ext := ".nar"
+			if compression == "zstd" {
+				ext = ".nar.zst"
+				d, err := zstd.NewReader(bytes.NewReader(file))
+				require.NoError(t, err)
+				file, err = io.ReadAll(d)
+				d.Close()
+				require.NoError(t, err)
+			}
+			assert.Equal(t, "nar/"+Nix32(fileHash[:])+ext, fields["URL"])
+			assert.Equal(t, "nar:"+hello, string(file))
+
+			added, err = AddToBinaryCache(dir, info, compression, key, nil)
+			require.NoError(t, err)
+			assert.False(t, added, "a path already in the cache is left alone")
+		})
+	}
+}
+
+func TestAddToBinaryCacheErrors(t *testing.T) {
+	fakeDump(t)
+	dir := t.TempDir()
+	require.NoError(t, InitBinaryCache(dir))
+
+	_, err := AddToBinaryCache(dir, fakeInfo(hello), "xz", nil, nil)
+	assert.ErrorContains(t, err, `not "xz"`)
+
+	bad := fakeInfo(hello)
+	bad.NarHash = emptyNix
+	_, err = AddToBinaryCache(dir, bad, "none", nil, nil)
+	assert.ErrorContains(t, err, "doesn't match its registered hash")
+
+	// nothing is left behind: no narinfo, no stray NARs
+	entries, _ := filepath.Glob(filepath.Join(dir, "*.narinfo"))
+	assert.Empty(t, entries)
+	nars, _ := os.ReadDir(filepath.Join(dir, "nar"))
+	assert.Empty(t, nars)
+
+	unsigned, err := AddToBinaryCache(dir, fakeInfo(glibc), "none", nil, nil)
+	require.NoError(t, err)
+	assert.True(t, unsigned)
+	assert.NotContains(t, narinfo(t, filepath.Join(dir, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.narinfo")), "Sig")
+}
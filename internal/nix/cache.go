@@ -16,6 +16,10 @@ type cachedEnv struct {
 	BashPath string `json:"bash_path"`
 	EnvPath  string `json:"env_path"`
 	PATH     string `json:"path"`
+
+	// sha256 of the env's closure, once a lagoon.lock check has hashed it. the
+	// closure of fixed store paths can't change, so later checks skip nix-store -qR
+	ClosureSHA256 string `json:"closure_sha256,omitempty"`
 }
 
 // contentSum returns a short hex hash of b
@@ -25,9 +29,9 @@ func contentSum(b []byte) string {
 }
 
 // LoadCache returns a cached ResolvedEnv if the sum matches (i.e. shell.nix unchanged).
-// returns nil, false on any miss or error.
-func LoadCache(cacheDir, sum string) (*ResolvedEnv, bool) {
-	data, err := os.ReadFile(filepath.Join(cacheDir, cacheFile))
+// envDir is the environment's own dir, Source.Dir. returns nil, false on any miss or error.
+func LoadCache(envDir, sum string) (*ResolvedEnv, bool) {
+	data, err := os.ReadFile(filepath.Join(envDir, cacheFile))
 	if err != nil {
 		return nil, false
 	}
@@ -38,12 +42,50 @@ func LoadCache(cacheDir, sum string) (*ResolvedEnv, bool) {
 	return &ResolvedEnv{BashPath: c.BashPath, EnvPath: c.EnvPath, PATH: c.PATH}, true
 }
 
+// loadClosure returns the closure sha256 saveClosure recorded for the env, or "".
+func loadClosure(envDir, sum string) string {
+	data, err := os.ReadFile(filepath.Join(envDir, cacheFile))
+	if err != nil {
+		return ""
+	}
+	var c cachedEnv
+	if json.Unmarshal(data, &c) != nil || c.Sum != sum {
+		return ""
+	}
+	return c.ClosureSHA256
+}
+
+// saveClosure adds the closure sha256 to the env's cache file. a re-resolve
+// rewrites the file without it, so a new set of paths is hashed afresh.
+func saveClosure(envDir, sum, closure string) error {
+	data, err := os.ReadFile(filepath.Join(envDir, cacheFile))
+	if err != nil {
+		return err
+	}
+	var c cachedEnv
+	if err := json.Unmarshal(data, &c); err != nil {
+		return err
+	}
+	if c.Sum != sum {
+		return fmt.Errorf("%s is for another environment", cacheFile)
+	}
+	c.ClosureSHA256 = closure
+	if data, err = json.Marshal(c); err != nil {
+		return err
+	}
+	return WriteAtomic(filepath.Join(envDir, cacheFile), data, 0644)
+}
+
 // SaveCache writes the resolved env to disk. errors here are non-fatal.
-func SaveCache(cacheDir string, env *ResolvedEnv, sum string) error {
+func SaveCache(envDir string, env *ResolvedEnv, sum string) error {
 	c := cachedEnv{Sum: sum, BashPath: env.BashPath, EnvPath: env.EnvPath, PATH: env.PATH}
 	data, err := json.Marshal(c)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filepath.Join(cacheDir, cacheFile), data, 0644)
+	if err := os.MkdirAll(envDir, 0755); err != nil {
+		return err
+	}
+	// readers don't take the lock, so they must never see half a file
+	return WriteAtomic(filepath.Join(envDir, cacheFile), data, 0644)
 }
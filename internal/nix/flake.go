@@ -0,0 +1,191 @@
+package nix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+)
+
+// Source is what Resolve evaluates: the generated shell.nix, or a flake devShell.
+type Source struct {
+	Path   string // shell.nix file, or the installable passed to nix develop
+	Flake  bool
+	Impure bool   // the flake reads local files outside itself, which pure evaluation forbids
+	Sum    string // changes whenever the environment may have on a given system; keys env.json and lagoon.lock
+	Dir    string // envsDir/<Sum>: env.json and gcroots, shared by every project with this sum
+
+	// where to fetch prebuilt paths from besides the user's nix.conf. not part of
+	// Sum: a cache changes how fast the environment builds, never what's in it
+	Substituters []string
+	TrustedKeys  []string
+
+	file    string // generated shell.nix or flake.nix, written by Write
+	content []byte
+}
+
+// Prepare works out what cfg resolves to and the sum of its environment dir under
+// envsDir. it only reads: the generated file is written by Write, once the caller
+// holds the env lock. projectDir anchors relative flake refs, local nix files and
+// the project's flake.lock.
+func Prepare(cfg *config.Config, envsDir, projectDir string) (*Source, error) {
+	var src *Source
+	var err error
+	switch {
+	case cfg.Flake != "":
+		src, err = projectFlake(cfg.Flake, projectDir)
+	case cfg.Nixpkgs != "":
+		src, err = generateFlake(cfg, envsDir, projectDir)
+	default:
+		if src, err = generateShellNix(cfg, projectDir, envsDir); err != nil {
+			err = fmt.Errorf("generating shell.nix: %w", err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	src.Dir = filepath.Join(envsDir, src.Sum)
+	src.Substituters = cfg.SubstituterURLs(projectDir)
+	src.TrustedKeys = cfg.TrustedKeys
+	return src, nil
+}
+
+// Write puts the generated shell.nix or flake.nix in place, skipping an
+// unchanged one. a project flake has nothing to write.
+func (s *Source) Write() error {
+	if s.file == "" {
+		return nil
+	}
+	if _, err := writeIfChanged(s.file, s.content); err != nil {
+		return fmt.Errorf("writing %s: %w", filepath.Base(s.file), err)
+	}
+	return nil
+}
+
+// projectFlake points at a devShell the project already defines, e.g. ".#dev".
+// for local flakes the sum covers flake.nix and flake.lock, so a bumped pin re-resolves.
+func projectFlake(ref, projectDir string) (*Source, error) {
+	ref, attr, _ := strings.Cut(ref, "#")
+	if attr == "" {
+		attr = "default"
+	}
+	var buf bytes.Buffer
+	buf.WriteString(ref + "#" + attr + "\n")
+	if ref == "" || strings.HasPrefix(ref, ".") || strings.HasPrefix(ref, "/") {
+		dir := filepath.Join(projectDir, ref)
+		b, err := os.ReadFile(filepath.Join(dir, "flake.nix"))
+		if err != nil {
+			return nil, fmt.Errorf("flake %q: %w", ref, err)
+		}
+		buf.Write(b)
+		lock, _ := os.ReadFile(filepath.Join(dir, "flake.lock")) // nix writes it on first use
+		buf.Write(lock)
+		ref = dir
+	}
+	return &Source{Path: ref + "#" + attr, Flake: true, Sum: contentSum(buf.Bytes())}, nil
+}
+
+// generateFlake renders flake.nix for envsDir/<sum>/flake — a directory of its own, since
+// nix copies the whole directory of a path: flake into the store. nix keeps flake.lock
+// next to it, so every project with this sum shares one lock.
+func generateFlake(cfg *config.Config, envsDir, projectDir string) (*Source, error) {
+	input, err := nixpkgsInput(cfg.Nixpkgs, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	local, err := readLocalNix(cfg, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	render := func(local *localNix, system string) string {
+		pkgs := fmt.Sprintf("nixpkgs.legacyPackages.%q", system)
+		if len(local.overlays) > 0 {
+			pkgs = fmt.Sprintf("import nixpkgs { system = %q; overlays = [ %s ]; }", system, strings.Join(local.overlays, " "))
+		}
+		content := flakeNixTemplate
+		content = strings.ReplaceAll(content, "{{NIXPKGS}}", input)
+		content = strings.ReplaceAll(content, "{{SYSTEM}}", system)
+		content = strings.ReplaceAll(content, "{{PKGS}}", pkgs)
+		pins := ""
+		for _, b := range pinBindings(cfg, fmt.Sprintf("{ system = %q; }", system)) {
+			pins += "\n        " + b
+		}
+		content = strings.ReplaceAll(content, "{{PINS}}", pins)
+		return strings.ReplaceAll(content, "{{PACKAGES}}", "          "+strings.Join(packageList(cfg, local), "\n          "))
+	}
+	content := render(local, nixSystem())
+
+	// the sum leaves out where the project is checked out and which system builds it,
+	// so every clone shares it. shell.nix never names a system; lagoon.lock keeps
+	// each system's paths apart
+	sum := contentSum(append([]byte(render(local.forSum(), "{{SYSTEM}}")), local.content...))
+	dir := filepath.Join(envsDir, sum, "flake")
+	return &Source{
+		Path:    "path:" + dir + "#default",
+		Flake:   true,
+		Impure:  len(local.content) > 0,
+		Sum:     sum,
+		file:    filepath.Join(dir, "flake.nix"),
+		content: []byte(content),
+	}, nil
+}
+
+// nixpkgsInput renders the nixpkgs input for the generated flake. "flake.lock" reuses
+// the exact nixpkgs the project's own flake is locked to, so there's one pin to bump.
+func nixpkgsInput(ref, projectDir string) (string, error) {
+	if ref != "flake.lock" {
+		return fmt.Sprintf("{ url = %q; }", ref), nil
+	}
+	b, err := os.ReadFile(filepath.Join(projectDir, "flake.lock"))
+	if err != nil {
+		return "", fmt.Errorf(`nixpkgs = "flake.lock": %w`, err)
+	}
+	var lock struct {
+		Root  string `json:"root"`
+		Nodes map[string]struct {
+			Inputs map[string]json.RawMessage `json:"inputs"`
+			Locked map[string]any             `json:"locked"`
+		} `json:"nodes"`
+	}
+	if err := json.Unmarshal(b, &lock); err != nil {
+		return "", fmt.Errorf("parsing flake.lock: %w", err)
+	}
+	// a root input is a node name; a list would mean it follows another flake's input
+	var node string
+	if err := json.Unmarshal(lock.Nodes[lock.Root].Inputs["nixpkgs"], &node); err != nil {
+		return "", fmt.Errorf("flake.lock has no nixpkgs input of its own")
+	}
+	locked := lock.Nodes[node].Locked
+	if len(locked) == 0 {
+		return "", fmt.Errorf("flake.lock: nixpkgs is not locked")
+	}
+	keys := make([]string, 0, len(locked))
+	for k := range locked {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := []string{"{"}
+	for _, k := range keys {
+		// the string attrs (type, owner, repo, rev, narHash, url…) fully identify it
+		if v, ok := locked[k].(string); ok {
+			attrs = append(attrs, fmt.Sprintf("%s = %q;", k, v))
+		}
+	}
+	return strings.Join(append(attrs, "}"), " "), nil
+}
+
+// nixSystem is the nix system double for this machine, e.g. "x86_64-linux". a var
+// so tests can stand in for another machine.
+var nixSystem = func() string {
+	arch := map[string]string{"amd64": "x86_64", "arm64": "aarch64", "386": "i686"}[runtime.GOARCH]
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	return arch + "-" + runtime.GOOS
+}
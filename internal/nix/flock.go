@@ -0,0 +1,88 @@
+package nix
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const lockFile = "lock"
+
+// LockEnv takes an exclusive advisory lock on an environment's cache dir, so only
+// one lagoon process resolves it at a time and the rest reuse its env.json.
+// waiting, if set, is called once when another process holds the lock.
+// the returned func releases it; the kernel does too if we die.
+func LockEnv(envDir string, waiting func()) (func(), error) {
+	return lockEnv(envDir, waiting, true)
+}
+
+// TryLockEnv is LockEnv without the wait: ok is false if the env is busy.
+func TryLockEnv(envDir string) (unlock func(), ok bool) {
+	unlock, err := lockEnv(envDir, nil, false)
+	return unlock, err == nil
+}
+
+func lockEnv(envDir string, waiting func(), wait bool) (func(), error) {
+	if err := os.MkdirAll(envDir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(envDir, lockFile)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, err
+		}
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if errors.Is(err, syscall.EWOULDBLOCK) && wait {
+			if waiting != nil {
+				waiting()
+				waiting = nil
+			}
+			err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		// lagoon gc may have removed the dir while we waited; a lock on the old file
+		// would exclude nobody, so start over on the one that's there now
+		held, _ := f.Stat()
+		cur, err := os.Stat(path)
+		if err == nil && os.SameFile(held, cur) {
+			return func() { f.Close() }, nil
+		}
+		f.Close()
+		if err := os.MkdirAll(envDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// WriteAtomic replaces path with data via a temp file and rename, so readers see
+// the old content or the new, never a partial write.
+func WriteAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	// flush before the rename, or a crash can leave path renamed but empty
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -10,8 +10,8 @@ import (
 // CreateGCRoots registers the full transitive closure of all sandbox packages as nix GC roots
 // so nix-collect-garbage won't delete shared libs or other transitive deps.
 // failures are silently ignored — the feature degrades gracefully if nix-store is unavailable.
-func CreateGCRoots(cacheDir string, env *ResolvedEnv) {
-	gcDir := filepath.Join(cacheDir, "gcroots")
+func CreateGCRoots(envDir string, env *ResolvedEnv) {
+	gcDir := filepath.Join(envDir, "gcroots")
 	os.MkdirAll(gcDir, 0755)
 
 	// collect unique top-level store paths from PATH
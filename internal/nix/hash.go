@@ -0,0 +1,76 @@
+package nix
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// nix32Chars is nix's base32 alphabet — no e, o, u or t, so hashes don't spell words.
+const nix32Chars = "0123456789abcdfghijklmnpqrsvwxyz"
+
+// Nix32 encodes b the way nix prints hashes in store paths and narinfo files.
+// it is not RFC 4648: bits are taken from the end of b backwards.
+func Nix32(b []byte) string {
+	n := (len(b)*8-1)/5 + 1
+	out := make([]byte, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		bit := i * 5
+		byteIdx, shift := bit/8, uint(bit%8)
+		c := b[byteIdx] >> shift
+		if byteIdx+1 < len(b) {
+			c |= b[byteIdx+1] << (8 - shift)
+		}
+		out = append(out, nix32Chars[c&0x1f])
+	}
+	return string(out)
+}
+
+// parseNix32 decodes a nix base32 string of a size-byte hash.
+func parseNix32(s string, size int) ([]byte, error) {
+	if len(s) != (size*8-1)/5+1 {
+		return nil, fmt.Errorf("nix32 hash %q has the wrong length", s)
+	}
+	b := make([]byte, size)
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(nix32Chars, s[len(s)-i-1])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid character %q in nix32 hash", s[len(s)-i-1])
+		}
+		bit := i * 5
+		byteIdx, shift := bit/8, uint(bit%8)
+		b[byteIdx] |= byte(digit << shift)
+		if carry := byte(digit >> (8 - shift)); byteIdx+1 < size {
+			b[byteIdx+1] |= carry
+		} else if carry != 0 {
+			return nil, fmt.Errorf("nix32 hash %q overflows", s)
+		}
+	}
+	return b, nil
+}
+
+// ParseSHA256 reads a sha256 in any of the forms nix prints: "sha256:" followed by
+// nix32 or hex, SRI ("sha256-" base64), or a bare nix32 or hex digest.
+func ParseSHA256(s string) ([]byte, error) {
+	if rest, ok := strings.CutPrefix(s, "sha256-"); ok {
+		b, err := base64.StdEncoding.DecodeString(rest)
+		if err != nil || len(b) != 32 {
+			return nil, fmt.Errorf("bad SRI sha256 %q", s)
+		}
+		return b, nil
+	}
+	s = strings.TrimPrefix(s, "sha256:")
+	switch len(s) {
+	case 64:
+		return hex.DecodeString(s)
+	case 52:
+		return parseNix32(s, 32)
+	}
+	return nil, fmt.Errorf("unrecognised sha256 %q", s)
+}
+
+// FormatSHA256 prints a digest the way narinfo files and lagoon manifests store it.
+func FormatSHA256(b []byte) string {
+	return "sha256:" + Nix32(b)
+}
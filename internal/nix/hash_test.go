@@ -0,0 +1,89 @@
+package nix
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hashes as nix-hash --type <algo> --base32 prints them
+func TestNix32Vectors(t *testing.T) {
+	abc256 := sha256.Sum256([]byte("abc"))
+	empty256 := sha256.Sum256(nil)
+	long256 := sha256.Sum256([]byte("abcdbcdecdefdefgefghfghighijhijkijkljklmklmnlmnomnopnopq"))
+	abc1 := sha1.Sum([]byte("abc"))
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{name: "sha256 empty", in: empty256[:], want: "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73"},
+		{name: "sha256 abc", in: abc256[:], want: "1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s"},
+		{name: "sha256 448 bits", in: long256[:], want: "1h86vccx9vgcyrkj3zv4b7j3r8rrc0z0r4r6q3jvhf06s9hnm394"},
+		{name: "sha1 abc", in: abc1[:], want: "kpcd173cq987hw957sx6m0868wv3x6d9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Nix32(tt.in))
+			back, err := parseNix32(tt.want, len(tt.in))
+			require.NoError(t, err)
+			assert.Equal(t, tt.in, back)
+		})
+	}
+}
+
+func TestNix32RoundTrip(t *testing.T) {
+	for _, size := range []int{1, 16, 20, 32, 64} {
+		b := make([]byte, size)
+		rand.Read(b)
+		s := Nix32(b)
+		assert.Len(t, s, (size*8-1)/5+1)
+		back, err := parseNix32(s, size)
+		require.NoError(t, err)
+		assert.Equal(t, b, back, "size %d", size)
+	}
+}
+
+func TestParseNix32Errors(t *testing.T) {
+	_, err := parseNix32("0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c7", 32)
+	assert.ErrorContains(t, err, "wrong length")
+	_, err = parseNix32("0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c7e", 32)
+	assert.ErrorContains(t, err, "invalid character")
+	// 52 digits hold 260 bits; a top digit past 1 would need a 33rd byte
+	_, err = parseNix32("zmdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73", 32)
+	assert.ErrorContains(t, err, "overflows")
+}
+
+func TestParseSHA256(t *testing.T) {
+	empty := sha256.Sum256(nil)
+	tests := []struct {
+		in      string
+		wantErr bool
+	}{
+		{in: "sha256:0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73"},
+		{in: "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73"},
+		{in: "sha256:" + hex.EncodeToString(empty[:])},
+		{in: hex.EncodeToString(empty[:])},
+		{in: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="},
+		{in: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuF==", wantErr: true},
+		{in: "sha256:abc", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSHA256(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, empty[:], got)
+		})
+	}
+	assert.Equal(t, "sha256:0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73", FormatSHA256(empty[:]))
+}
@@ -0,0 +1,39 @@
+package nix
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+)
+
+// packageList is every entry for the generated package list: lagoon.toml's packages
+// (pinned ones from their own revision), then one interpreter environment per
+// language section, then local packages.
+func packageList(cfg *config.Config, local *localNix) []string {
+	var list []string
+	for _, p := range cfg.Packages {
+		list = append(list, packageAttr(p))
+	}
+	for _, l := range cfg.Langs() {
+		list = append(list, langExprs(l)...)
+	}
+	return append(list, local.packages...)
+}
+
+// langExprs turns a language section into package list entries.
+func langExprs(l config.Lang) []string {
+	pkgs := strings.Join(l.Packages, " ")
+	switch l.Name {
+	case "r":
+		return []string{fmt.Sprintf("(rWrapper.override { packages = with rPackages; [ %s ]; })", pkgs)}
+	case "node":
+		// node has no withPackages — libraries belong in package.json, these are CLI tools
+		exprs := []string{l.Attr()}
+		for _, p := range l.Packages {
+			exprs = append(exprs, "nodePackages."+p)
+		}
+		return exprs
+	}
+	return []string{fmt.Sprintf("(%s.withPackages (ps: with ps; [ %s ]))", l.Attr(), pkgs)}
+}
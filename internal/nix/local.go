@@ -0,0 +1,143 @@
+package nix
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+)
+
+// localNix is what lagoon.toml's local_packages and overlays add to a generated expression.
+type localNix struct {
+	packages []string // package list entries
+	overlays []string // overlay expressions, applied when nixpkgs is imported
+	content  []byte   // the files themselves — the generated text only names them, so they go into the sum
+
+	// the same entries naming files relative to the project, for the sum: the
+	// built expression needs absolute paths, but a checkout elsewhere is the same env
+	relPackages []string
+	relOverlays []string
+}
+
+// readLocalNix reads every local package and overlay file, resolved against projectDir.
+func readLocalNix(cfg *config.Config, projectDir string) (*localNix, error) {
+	l := &localNix{}
+	for _, p := range cfg.LocalPackages {
+		path, b, err := readNixFile(projectDir, p)
+		if err != nil {
+			return nil, err
+		}
+		l.packages = append(l.packages, fmt.Sprintf("(callPackage %s { })", nixPath(path)))
+		l.relPackages = append(l.relPackages, fmt.Sprintf("(callPackage %s { })", relNixPath(projectDir, path)))
+		l.content = append(l.content, b...)
+	}
+	for _, p := range cfg.Overlays {
+		path, b, err := readNixFile(projectDir, p)
+		if err != nil {
+			return nil, err
+		}
+		l.overlays = append(l.overlays, fmt.Sprintf("(import %s)", nixPath(path)))
+		l.relOverlays = append(l.relOverlays, fmt.Sprintf("(import %s)", relNixPath(projectDir, path)))
+		l.content = append(l.content, b...)
+	}
+	return l, nil
+}
+
+// forSum returns l with its files named relative to the project, for rendering the
+// text an env's sum is taken over.
+func (l *localNix) forSum() *localNix {
+	return &localNix{packages: l.relPackages, overlays: l.relOverlays, content: l.content}
+}
+
+// relNixPath renders path relative to projectDir when it's inside it. files
+// outside the project keep their absolute path — that's what lagoon.toml names.
+func relNixPath(projectDir, path string) string {
+	rel, err := filepath.Rel(projectDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return nixPath(path)
+	}
+	return nixPath("./" + filepath.ToSlash(rel))
+}
+
+// importArgs is the argument set nixpkgs is imported with.
+func (l *localNix) importArgs() string {
+	if len(l.overlays) == 0 {
+		return "{}"
+	}
+	return "{ overlays = [ " + strings.Join(l.overlays, " ") + " ]; }"
+}
+
+// readNixFile resolves p against projectDir and reads it. a directory stands for
+// its default.nix, but that can import anything beside it, so every file in the
+// tree is read.
+func readNixFile(projectDir, p string) (string, []byte, error) {
+	path := p
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(projectDir, p)
+	}
+	fi, err := os.Stat(path)
+	if err == nil && fi.IsDir() {
+		if _, err := os.Stat(filepath.Join(path, "default.nix")); err != nil {
+			return "", nil, fmt.Errorf("local nix dir %q: %w", p, err)
+		}
+		b, err := readTree(path)
+		if err != nil {
+			return "", nil, fmt.Errorf("local nix dir %q: %w", p, err)
+		}
+		return path, b, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("local nix file %q: %w", p, err)
+	}
+	return path, b, nil
+}
+
+// readTree concatenates every file under dir with its relative path, in walk
+// order, so a rename changes the result as well as an edit. symlinks count by target.
+func readTree(dir string) ([]byte, error) {
+	var out []byte
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(dir, file)
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			out = fmt.Appendf(out, "%s -> %s\x00", rel, target)
+		case d.Type().IsRegular():
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			out = fmt.Appendf(out, "%s %d\x00", rel, len(b))
+			out = append(out, b...)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// plainPathRe matches paths nix accepts as a bare path literal.
+var plainPathRe = regexp.MustCompile(`^[A-Za-z0-9._/+-]+$`)
+
+// nixPath renders an absolute path as a nix path value.
+func nixPath(p string) string {
+	if plainPathRe.MatchString(p) {
+		return p
+	}
+	// spaces and the like need the string form; escape what nix strings treat specially
+	esc := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`).Replace(p)
+	return `(/. + "` + esc + `")`
+}
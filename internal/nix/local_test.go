@@ -0,0 +1,102 @@
+package nix
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadNixFileDir(t *testing.T) {
+	project := t.TempDir()
+	pkg := filepath.Join(project, "nix", "mytool")
+	require.NoError(t, os.MkdirAll(pkg, 0755))
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(pkg, name), []byte(content), 0644))
+	}
+	write("default.nix", "{ callPackage }: callPackage ./package.nix { }")
+	write("package.nix", "{ stdenv }: stdenv.mkDerivation { }")
+	read := func() []byte {
+		path, b, err := readNixFile(project, "./nix/mytool")
+		require.NoError(t, err)
+		assert.Equal(t, pkg, path)
+		return b
+	}
+
+	first := read()
+	assert.Equal(t, first, read(), "same tree, same content")
+
+	// default.nix is unchanged; only what it imports is
+	write("package.nix", "{ stdenv }: stdenv.mkDerivation { name = \"x\"; }")
+	edited := read()
+	assert.NotEqual(t, first, edited, "an edit beside default.nix counts")
+
+	require.NoError(t, os.Rename(filepath.Join(pkg, "package.nix"), filepath.Join(pkg, "pkg.nix")))
+	assert.NotEqual(t, edited, read(), "a rename counts")
+
+	require.NoError(t, os.Remove(filepath.Join(pkg, "default.nix")))
+	_, _, err := readNixFile(project, "./nix/mytool")
+	assert.ErrorContains(t, err, `local nix dir "./nix/mytool"`)
+}
+
+func TestReadNixFile(t *testing.T) {
+	project := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(project, "overlay.nix"), []byte("final: prev: { }"), 0644))
+	path, b, err := readNixFile(project, "overlay.nix")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(project, "overlay.nix"), path)
+	assert.Equal(t, "final: prev: { }", string(b))
+
+	_, _, err = readNixFile(project, "missing.nix")
+	assert.ErrorContains(t, err, `local nix file "missing.nix"`)
+}
+
+func TestSumIgnoresCheckoutPath(t *testing.T) {
+	checkout := func() string {
+		project := t.TempDir()
+		pkg := filepath.Join(project, "nix", "mytool")
+		require.NoError(t, os.MkdirAll(pkg, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(pkg, "default.nix"), []byte("{ stdenv }: stdenv.mkDerivation { }"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(project, "overlay.nix"), []byte("final: prev: { }"), 0644))
+		return project
+	}
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{
+			name: "shell.nix",
+			cfg:  config.Config{NixpkgsCommit: config.DefaultCommit, NixpkgsSHA256: config.DefaultSHA256},
+		},
+		{
+			name: "flake",
+			cfg:  config.Config{Nixpkgs: "github:NixOS/nixpkgs/nixos-unstable"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.LocalPackages = []string{"./nix/mytool"}
+			cfg.Overlays = []string{"overlay.nix"}
+			envs := t.TempDir()
+			a, b := checkout(), checkout()
+			srcA, err := Prepare(&cfg, envs, a)
+			require.NoError(t, err)
+			srcB, err := Prepare(&cfg, envs, b)
+			require.NoError(t, err)
+
+			assert.Equal(t, srcA.Sum, srcB.Sum, "same project, same sum")
+			// the file that gets built still names each checkout's own files
+			assert.Contains(t, string(srcA.content), filepath.Join(a, "overlay.nix"))
+			assert.Contains(t, string(srcB.content), filepath.Join(b, "overlay.nix"))
+
+			require.NoError(t, os.WriteFile(filepath.Join(b, "overlay.nix"), []byte("final: prev: { x = 1; }"), 0644))
+			srcB, err = Prepare(&cfg, envs, b)
+			require.NoError(t, err)
+			assert.NotEqual(t, srcA.Sum, srcB.Sum, "an edit still counts")
+		})
+	}
+}
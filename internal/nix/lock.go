@@ -0,0 +1,161 @@
+package nix
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LockFilename sits next to lagoon.toml and is meant to be committed with it.
+const LockFilename = "lagoon.lock"
+
+// Lock records what the environment actually resolved to on the machines that wrote it.
+// lagoon.toml pins nixpkgs; the lock pins the resulting store paths.
+type Lock struct {
+	Sum           string                `toml:"sum"`                      // shell.nix or flake sum the paths were resolved from
+	NixpkgsCommit string                `toml:"nixpkgs_commit,omitempty"` // empty for flakes — flake.lock pins those
+	Systems       map[string]*LockEntry `toml:"systems"`                  // keyed by nix system, e.g. "x86_64-linux"
+}
+
+// LockEntry is what one system resolved: the same sum builds different paths on
+// x86_64 and aarch64.
+type LockEntry struct {
+	ClosureSHA256 string   `toml:"closure_sha256"` // sha256 over the sorted transitive closure
+	Paths         []string `toml:"paths"`          // top-level store paths, sorted
+}
+
+// System is the nix system whose entry Verify and Record use.
+func System() string {
+	return nixSystem()
+}
+
+// Entry returns this system's entry, or nil if no machine like this one has recorded one.
+func (l *Lock) Entry() *LockEntry {
+	return l.Systems[nixSystem()]
+}
+
+// StorePaths returns the unique top-level nix store paths on the environment PATH,
+// in PATH order.
+func StorePaths(env *ResolvedEnv) []string {
+	seen := map[string]bool{}
+	var paths []string
+	for _, entry := range strings.Split(env.PATH, ":") {
+		sp := filepath.Dir(entry)
+		if strings.HasPrefix(sp, "/nix/store/") && !seen[sp] {
+			seen[sp] = true
+			paths = append(paths, sp)
+		}
+	}
+	return paths
+}
+
+// NewLock builds a lock for env with this system's entry. it runs nix-store -qR to
+// hash the full closure, so only call it after a resolve — not on every warm start.
+func NewLock(env *ResolvedEnv, sum, commit string) (*Lock, error) {
+	l := &Lock{Sum: sum, NixpkgsCommit: commit}
+	if err := l.Record(env); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record sets this system's entry from env, leaving other systems' alone.
+func (l *Lock) Record(env *ResolvedEnv) error {
+	paths := StorePaths(env)
+	if len(paths) == 0 {
+		return fmt.Errorf("no nix store paths in environment PATH")
+	}
+	closure, err := closureSum(paths)
+	if err != nil {
+		return err
+	}
+	slices.Sort(paths)
+	if l.Systems == nil {
+		l.Systems = map[string]*LockEntry{}
+	}
+	l.Systems[nixSystem()] = &LockEntry{ClosureSHA256: closure, Paths: paths}
+	return nil
+}
+
+// closureSum hashes the transitive closure of paths.
+func closureSum(paths []string) (string, error) {
+	out, err := exec.Command("nix-store", append([]string{"-qR"}, paths...)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("nix-store -qR: %w", err)
+	}
+	return ClosureSum(strings.Fields(string(out))), nil
+}
+
+// ClosureSum hashes a closure independently of the order nix-store printed it in.
+func ClosureSum(closure []string) string {
+	sorted := slices.Clone(closure)
+	slices.Sort(sorted)
+	h := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return fmt.Sprintf("%x", h)
+}
+
+// ReadLock parses a lock file. a missing file returns an error satisfying os.IsNotExist.
+func ReadLock(path string) (*Lock, error) {
+	var l Lock
+	if _, err := toml.DecodeFile(path, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// WriteLock encodes l to path.
+func WriteLock(path string, l *Lock) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(f, "# generated by lagoon — commit this file, do not edit by hand")
+	err = toml.NewEncoder(f).Encode(l)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Verify compares env's top-level store paths against this system's entry, which
+// must exist. returns the paths that are in the lock but not in env, and vice versa. when
+// those match, the closure is hashed too — same top-level paths can still pull in
+// different dependencies — and a mismatch is an error. the hash is recorded in
+// envDir's env.json, so only the first check of a resolved env runs nix-store -qR.
+func (l *Lock) Verify(env *ResolvedEnv, envDir string) (missing, extra []string, err error) {
+	e := l.Entry()
+	if e == nil {
+		return nil, nil, fmt.Errorf("lagoon.lock has no entry for %s", nixSystem())
+	}
+	got := StorePaths(env)
+	for _, p := range e.Paths {
+		if !slices.Contains(got, p) {
+			missing = append(missing, p)
+		}
+	}
+	for _, p := range got {
+		if !slices.Contains(e.Paths, p) {
+			extra = append(extra, p)
+		}
+	}
+	if len(missing) > 0 || len(extra) > 0 {
+		return missing, extra, nil
+	}
+	closure := loadClosure(envDir, l.Sum)
+	if closure == "" {
+		if closure, err = closureSum(got); err != nil {
+			return nil, nil, err
+		}
+		_ = saveClosure(envDir, l.Sum, closure)
+	}
+	if closure != e.ClosureSHA256 {
+		return nil, nil, fmt.Errorf("the environment's closure doesn't match lagoon.lock's closure_sha256")
+	}
+	return nil, nil, nil
+}
@@ -0,0 +1,111 @@
+package nix
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQueryRequisites puts a nix-store on PATH whose -qR prints its arguments plus
+// glibc, and logs each call to the returned file.
+func fakeQueryRequisites(t *testing.T) string {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\n[ \"$1\" = -qR ] || exit 1\necho qR >> " + calls + "\nshift\necho " + glibc + "\nfor p; do echo \"$p\"; done\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nix-store"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+func TestVerifyRecordsClosure(t *testing.T) {
+	calls := fakeQueryRequisites(t)
+	countCalls := func() int {
+		b, _ := os.ReadFile(calls)
+		return strings.Count(string(b), "qR")
+	}
+	env := &ResolvedEnv{BashPath: bash + "/bin/bash", PATH: hello + "/bin:" + bash + "/bin"}
+	envDir := t.TempDir()
+	require.NoError(t, SaveCache(envDir, env, "0123abcd"))
+
+	lock, err := NewLock(env, "0123abcd", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{bash, hello}, lock.Entry().Paths)
+	assert.Equal(t, ClosureSum([]string{glibc, hello, bash}), lock.Entry().ClosureSHA256)
+	require.Equal(t, 1, countCalls())
+
+	for range 2 {
+		missing, extra, err := lock.Verify(env, envDir)
+		require.NoError(t, err)
+		assert.Empty(t, missing)
+		assert.Empty(t, extra)
+	}
+	assert.Equal(t, 2, countCalls(), "the second check reads the closure from env.json")
+
+	// a re-resolve forgets it
+	require.NoError(t, SaveCache(envDir, env, "0123abcd"))
+	lock.Entry().ClosureSHA256 = ClosureSum([]string{hello, bash})
+	_, _, err = lock.Verify(env, envDir)
+	assert.ErrorContains(t, err, "closure doesn't match")
+	assert.Equal(t, 3, countCalls())
+	_, _, err = lock.Verify(env, envDir)
+	assert.ErrorContains(t, err, "closure doesn't match", "a recorded closure is still checked")
+	assert.Equal(t, 3, countCalls())
+
+	// paths that differ never get as far as the closure
+	missing, extra, err := lock.Verify(&ResolvedEnv{PATH: glibc + "/bin:" + bash + "/bin"}, envDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{hello}, missing)
+	assert.Equal(t, []string{glibc}, extra)
+}
+
+// asSystem makes this machine look like system until the test ends.
+func asSystem(t *testing.T, system string) {
+	orig := nixSystem
+	nixSystem = func() string { return system }
+	t.Cleanup(func() { nixSystem = orig })
+}
+
+func TestLockPerSystem(t *testing.T) {
+	fakeQueryRequisites(t)
+	path := filepath.Join(t.TempDir(), LockFilename)
+
+	asSystem(t, "x86_64-linux")
+	lock, err := NewLock(&ResolvedEnv{PATH: hello + "/bin"}, "0123abcd", "")
+	require.NoError(t, err)
+	require.NoError(t, WriteLock(path, lock))
+
+	asSystem(t, "aarch64-linux")
+	lock, err = ReadLock(path)
+	require.NoError(t, err)
+	assert.Nil(t, lock.Entry(), "no entry for a system that hasn't resolved")
+	_, _, err = lock.Verify(&ResolvedEnv{PATH: bash + "/bin"}, t.TempDir())
+	assert.ErrorContains(t, err, "no entry for aarch64-linux")
+	require.NoError(t, lock.Record(&ResolvedEnv{PATH: bash + "/bin"}))
+	require.NoError(t, WriteLock(path, lock))
+
+	lock, err = ReadLock(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{bash}, lock.Entry().Paths)
+	asSystem(t, "x86_64-linux")
+	assert.Equal(t, []string{hello}, lock.Entry().Paths, "recording one system keeps the other")
+}
+
+func TestFlakeSumIgnoresSystem(t *testing.T) {
+	cfg := config.Config{Nixpkgs: "github:NixOS/nixpkgs/nixos-unstable", Packages: []config.Package{{Name: "hello"}}}
+	envs, project := t.TempDir(), t.TempDir()
+	prepare := func(system string) *Source {
+		asSystem(t, system)
+		src, err := Prepare(&cfg, envs, project)
+		require.NoError(t, err)
+		return src
+	}
+	x86, arm := prepare("x86_64-linux"), prepare("aarch64-linux")
+	assert.Equal(t, x86.Sum, arm.Sum)
+	assert.Contains(t, string(x86.content), `"x86_64-linux"`)
+	assert.Contains(t, string(arm.content), `"aarch64-linux"`)
+}
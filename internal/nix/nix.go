@@ -18,40 +18,66 @@ import (
 
 // ResolvedEnv holds the paths we capture from running nix-shell
 type ResolvedEnv struct {
-	BashPath string
-	EnvPath  string
-	PATH     string
+	BashPath string `json:"bash_path"`
+	EnvPath  string `json:"env_path"`
+	PATH     string `json:"path"`
 }
 
-// GenerateShellNix writes shell.nix to outPath if the content changed.
-// returns the sha256 sum of the generated content for cache lookups.
-func GenerateShellNix(cfg *config.Config, outPath string) (string, error) {
-	content := shellNixTemplate
-	content = strings.ReplaceAll(content, "{{COMMIT}}", cfg.NixpkgsCommit)
-	content = strings.ReplaceAll(content, "{{SHA256}}", cfg.NixpkgsSHA256)
-	content = strings.ReplaceAll(content, "{{PACKAGES}}", "    "+strings.Join(cfg.Packages, "\n    "))
+// generateShellNix renders shell.nix for envsDir/<sum>, the environment's shared
+// cache dir. the sum covers the generated content and any local nix files it uses,
+// which are resolved against projectDir. nothing is written until Source.Write.
+func generateShellNix(cfg *config.Config, projectDir, envsDir string) (*Source, error) {
+	local, err := readLocalNix(cfg, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	render := func(local *localNix) string {
+		content := shellNixTemplate
+		content = strings.ReplaceAll(content, "{{COMMIT}}", cfg.NixpkgsCommit)
+		content = strings.ReplaceAll(content, "{{SHA256}}", cfg.NixpkgsSHA256)
+		content = strings.ReplaceAll(content, "{{IMPORT_ARGS}}", local.importArgs())
+		content = strings.ReplaceAll(content, "{{PINS}}", pinsLet(cfg))
+		return strings.ReplaceAll(content, "{{PACKAGES}}", "    "+strings.Join(packageList(cfg, local), "\n    "))
+	}
+	// the sum leaves out where the project is checked out, so every clone shares the env
+	sum := contentSum(append([]byte(render(local.forSum())), local.content...))
+	path := filepath.Join(envsDir, sum, "shell.nix")
+	return &Source{Path: path, Sum: sum, file: path, content: []byte(render(local))}, nil
+}
 
-	sum := contentSum([]byte(content))
+// writeIfChanged writes content to path unless it's already there, and returns its sum.
+func writeIfChanged(path string, content []byte) (string, error) {
+	sum := contentSum(content)
 
 	// skip the write if the file already has this exact content
-	if existing, err := os.ReadFile(outPath); err == nil && contentSum(existing) == sum {
+	if existing, err := os.ReadFile(path); err == nil && contentSum(existing) == sum {
 		return sum, nil
 	}
 
-	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return "", err
 	}
-	return sum, os.WriteFile(outPath, []byte(content), 0644)
+	// another lagoon may be generating the same file, or nix reading it
+	return sum, WriteAtomic(path, content, 0644)
 }
 
 // GenerateDockerNix writes docker.nix to outPath using the docker image template.
 // name is the image name (e.g. "lagoon-myapp").
-func GenerateDockerNix(cfg *config.Config, outPath, name string) error {
+func GenerateDockerNix(cfg *config.Config, projectDir, outPath, name string) error {
+	if cfg.UsesFlakes() {
+		return fmt.Errorf("lagoon docker needs nixpkgs_commit — flake environments aren't supported yet")
+	}
+	local, err := readLocalNix(cfg, projectDir)
+	if err != nil {
+		return err
+	}
 	content := dockerNixTemplate
 	content = strings.ReplaceAll(content, "{{COMMIT}}", cfg.NixpkgsCommit)
 	content = strings.ReplaceAll(content, "{{SHA256}}", cfg.NixpkgsSHA256)
+	content = strings.ReplaceAll(content, "{{IMPORT_ARGS}}", local.importArgs())
 	content = strings.ReplaceAll(content, "{{NAME}}", name)
-	content = strings.ReplaceAll(content, "{{PACKAGES}}", "    "+strings.Join(cfg.Packages, "\n    "))
+	content = strings.ReplaceAll(content, "{{PINS}}", pinsLet(cfg))
+	content = strings.ReplaceAll(content, "{{PACKAGES}}", "    "+strings.Join(packageList(cfg, local), "\n    "))
 	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
 		return err
 	}
@@ -64,16 +90,27 @@ var missingAttrRe = regexp.MustCompile(`attribute '([^']+)' missing`)
 // nixKeywords are the substrings we surface from nix stderr so users see progress
 var nixKeywords = []string{"fetching", "downloading", "building", "copying", "error", "warning"}
 
-// Resolve runs nix-shell and grabs the bash path, env path, and PATH value.
+// Resolve runs nix-shell (or nix develop for flakes) and grabs the bash path, env path, and PATH value.
 // matching stderr lines are sent to progress as they arrive; caller closes the channel after use.
 // 30 min timeout covers cold builds; warm cache hits finish in seconds.
-func Resolve(shellNixPath string, progress chan<- string) (*ResolvedEnv, error) {
+func Resolve(src *Source, progress chan<- string) (*ResolvedEnv, error) {
 	var stderrBuf bytes.Buffer
 	pr, pw := io.Pipe()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, "nix-shell", shellNixPath, "--run",
-		"which bash && which env && echo $PATH")
+	const script = "which bash && which env && echo $PATH"
+	tool := "nix-shell"
+	cmd := exec.CommandContext(ctx, "nix-shell", append(append([]string{src.Path}, substituterArgs(src)...), "--run", script)...)
+	if src.Flake {
+		tool = "nix develop"
+		// flakes are still experimental on a default nix install
+		args := []string{"--extra-experimental-features", "nix-command flakes", "develop", src.Path}
+		if src.Impure {
+			args = append(args, "--impure")
+		}
+		args = append(args, substituterArgs(src)...)
+		cmd = exec.CommandContext(ctx, "nix", append(args, "--command", "bash", "-c", script)...)
+	}
 	// strip NIX_* vars so host nix config doesn't influence package resolution
 	cmd.Env = filterOutNixEnv(os.Environ())
 	cmd.Stderr = io.MultiWriter(&stderrBuf, pw)
@@ -102,12 +139,25 @@ func Resolve(shellNixPath string, progress chan<- string) (*ResolvedEnv, error)
 	<-done
 
 	if err != nil {
-		return nil, parseNixError(stderrBuf.Bytes())
+		return nil, parseNixError(tool, stderrBuf.Bytes())
 	}
 
 	return parseResolveOutput(string(stdout))
 }
 
+// substituterArgs adds the project's binary caches to the user's. nix only uses them
+// if the daemon trusts this user or lists them in trusted-substituters.
+func substituterArgs(src *Source) []string {
+	var args []string
+	if len(src.Substituters) > 0 {
+		args = append(args, "--option", "extra-substituters", strings.Join(src.Substituters, " "))
+	}
+	if len(src.TrustedKeys) > 0 {
+		args = append(args, "--option", "extra-trusted-public-keys", strings.Join(src.TrustedKeys, " "))
+	}
+	return args
+}
+
 // parseResolveOutput parses stdout from: which bash && which env && echo $PATH
 // finds bash/env by suffix match rather than position so stray lines don't break it.
 func parseResolveOutput(stdout string) (*ResolvedEnv, error) {
@@ -159,7 +209,7 @@ func filterOutNixEnv(env []string) []string {
 }
 
 // parseNixError turns the raw nix error into something a human can act on
-func parseNixError(output []byte) error {
+func parseNixError(tool string, output []byte) error {
 	raw := string(output)
 
 	// look for the common "attribute missing" pattern — that's a typo'd package name
@@ -168,5 +218,5 @@ func parseNixError(output []byte) error {
 	}
 
 	// unknown error — show it but label it clearly so users know what they're looking at
-	return fmt.Errorf("nix-shell failed\n--- raw nix output ---\n%s", raw)
+	return fmt.Errorf("%s failed\n--- raw nix output ---\n%s", tool, raw)
 }
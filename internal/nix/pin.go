@@ -0,0 +1,68 @@
+package nix
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+)
+
+// pinVar is the let binding a pinned nixpkgs revision is imported as.
+func pinVar(commit string) string {
+	return "pin_" + commit[:12]
+}
+
+// pinBindings imports each distinct revision that packages are pinned to, once.
+// args is what each is imported with — overlays stay on the project's own nixpkgs.
+func pinBindings(cfg *config.Config, args string) []string {
+	var binds []string
+	seen := map[string]bool{}
+	for _, p := range cfg.Packages {
+		if !p.Pinned() || seen[p.NixpkgsCommit] {
+			continue
+		}
+		seen[p.NixpkgsCommit] = true
+		binds = append(binds, fmt.Sprintf(`%s = import (fetchTarball { url = "https://github.com/NixOS/nixpkgs/archive/%s.tar.gz"; sha256 = "%s"; }) %s;`,
+			pinVar(p.NixpkgsCommit), p.NixpkgsCommit, p.NixpkgsSHA256, args))
+	}
+	return binds
+}
+
+// pinsLet renders pinBindings as a let block in front of the shell or docker expression.
+// empty without pins, so existing shell.nix files and their sums don't change.
+func pinsLet(cfg *config.Config) string {
+	binds := pinBindings(cfg, "{}")
+	if len(binds) == 0 {
+		return ""
+	}
+	return "let\n  " + strings.Join(binds, "\n  ") + "\nin\n"
+}
+
+// packageAttr is how a package list entry names p.
+func packageAttr(p config.Package) string {
+	if !p.Pinned() {
+		return p.Name
+	}
+	return pinVar(p.NixpkgsCommit) + "." + p.Name
+}
+
+// HasPinnedAttr reports whether p's own nixpkgs revision has an attribute named p.Name.
+// the first call for a revision downloads it, which lagoon shell would need anyway.
+func HasPinnedAttr(p config.Package) (bool, error) {
+	// the name goes in as an argument, never spliced into the expression
+	expr := fmt.Sprintf(`{ name }: let p = import (fetchTarball { url = "https://github.com/NixOS/nixpkgs/archive/%s.tar.gz"; sha256 = "%s"; }) {}; in p.lib.hasAttrByPath (p.lib.splitString "." name) p`,
+		p.NixpkgsCommit, p.NixpkgsSHA256)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "nix-instantiate", "--eval", "--expr", expr, "--argstr", "name", p.Name)
+	cmd.Env = filterOutNixEnv(os.Environ())
+	out, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("nix-instantiate: %w", err)
+	}
+	return strings.TrimSpace(string(out)) == "true", nil
+}
@@ -0,0 +1,110 @@
+package nix
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// keys and signatures use nix's text format, "name:base64", so keys made with
+// nix-store --generate-binary-cache-key work here and ours work in nix.conf.
+
+// SecretKey signs bundles and narinfo files.
+type SecretKey struct {
+	Name string
+	Key  ed25519.PrivateKey
+}
+
+// PublicKey checks signatures made by the matching SecretKey.
+type PublicKey struct {
+	Name string
+	Key  ed25519.PublicKey
+}
+
+// GenerateKey makes a new key pair. name is conventionally a host name plus a
+// number, e.g. "build.example.com-1", so keys can be rotated.
+func GenerateKey(name string) (*SecretKey, error) {
+	if err := checkKeyName(name); err != nil {
+		return nil, err
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretKey{Name: name, Key: key}, nil
+}
+
+func checkKeyName(name string) error {
+	if name == "" || strings.ContainsAny(name, ": \t\n") {
+		return fmt.Errorf("key name %q must be non-empty, without spaces or ':'", name)
+	}
+	return nil
+}
+
+// splitKey parses "name:base64" holding size bytes.
+func splitKey(s string, size int, what string) (string, []byte, error) {
+	name, data, found := strings.Cut(strings.TrimSpace(s), ":")
+	if !found || checkKeyName(name) != nil {
+		return "", nil, fmt.Errorf("%s must look like name:base64", what)
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(b) != size {
+		return "", nil, fmt.Errorf("%s %q: not a %d-byte base64 ed25519 key", what, name, size)
+	}
+	return name, b, nil
+}
+
+// ParseSecretKey reads a secret key in nix format.
+func ParseSecretKey(s string) (*SecretKey, error) {
+	name, b, err := splitKey(s, ed25519.PrivateKeySize, "secret key")
+	if err != nil {
+		return nil, err
+	}
+	return &SecretKey{Name: name, Key: b}, nil
+}
+
+// ParsePublicKey reads a public key in nix format.
+func ParsePublicKey(s string) (*PublicKey, error) {
+	name, b, err := splitKey(s, ed25519.PublicKeySize, "public key")
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKey{Name: name, Key: b}, nil
+}
+
+func (k *SecretKey) String() string {
+	return k.Name + ":" + base64.StdEncoding.EncodeToString(k.Key)
+}
+
+func (k *PublicKey) String() string {
+	return k.Name + ":" + base64.StdEncoding.EncodeToString(k.Key)
+}
+
+// Public returns the key that verifies k's signatures.
+func (k *SecretKey) Public() *PublicKey {
+	return &PublicKey{Name: k.Name, Key: k.Key.Public().(ed25519.PublicKey)}
+}
+
+// Sign returns a signature of msg as "name:base64".
+func (k *SecretKey) Sign(msg []byte) string {
+	return k.Name + ":" + base64.StdEncoding.EncodeToString(ed25519.Sign(k.Key, msg))
+}
+
+// Verify reports whether sig is k's signature of msg. signatures by other key
+// names never match, as in nix.
+func (k *PublicKey) Verify(msg []byte, sig string) bool {
+	name, data, found := strings.Cut(sig, ":")
+	if !found || name != k.Name {
+		return false
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	return err == nil && len(b) == ed25519.SignatureSize && ed25519.Verify(k.Key, msg, b)
+}
+
+// SignerName returns the key name a signature claims to be from.
+func SignerName(sig string) string {
+	name, _, _ := strings.Cut(sig, ":")
+	return name
+}
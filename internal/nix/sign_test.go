@@ -0,0 +1,120 @@
+package nix
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc8032Key loads an RFC 8032 section 7.1 test key through nix's name:base64
+// form — base64 of seed plus public key, as nix-store --generate-binary-cache-key writes.
+func rfc8032Key(t *testing.T, seedHex string) *SecretKey {
+	seed, err := hex.DecodeString(seedHex)
+	require.NoError(t, err)
+	key, err := ParseSecretKey("test-1:" + base64.StdEncoding.EncodeToString(ed25519.NewKeyFromSeed(seed)))
+	require.NoError(t, err)
+	return key
+}
+
+func TestSignVectors(t *testing.T) {
+	tests := []struct {
+		name   string
+		seed   string
+		public string
+		msg    string
+		sig    string
+	}{
+		{
+			name:   "rfc 8032 test 1",
+			seed:   "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+			public: "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+			msg:    "",
+			sig:    "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b",
+		},
+		{
+			name:   "rfc 8032 test 2",
+			seed:   "4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb",
+			public: "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+			msg:    "\x72",
+			sig:    "92a009a9f0d4cab8720e820b5f642540a2b27b5416503f8fb3762223ebdb69da085ac1e43e15996e458f3613d0f11d8c387b2eaeb4302aeeb00d291612bb0c00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := rfc8032Key(t, tt.seed)
+			pub, _ := hex.DecodeString(tt.public)
+			sig, _ := hex.DecodeString(tt.sig)
+
+			assert.Equal(t, "test-1:"+base64.StdEncoding.EncodeToString(pub), key.Public().String())
+			want := "test-1:" + base64.StdEncoding.EncodeToString(sig)
+			assert.Equal(t, want, key.Sign([]byte(tt.msg)))
+
+			parsed, err := ParsePublicKey(key.Public().String())
+			require.NoError(t, err)
+			assert.True(t, parsed.Verify([]byte(tt.msg), want))
+			assert.False(t, parsed.Verify([]byte(tt.msg+"x"), want))
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	key, err := GenerateKey("build-1")
+	require.NoError(t, err)
+	msg := []byte("1;/nix/store/x;sha256:y;1;")
+	sig := key.Sign(msg)
+	renamed := &PublicKey{Name: "build-2", Key: key.Public().Key}
+	tests := map[string]struct {
+		key *PublicKey
+		sig string
+	}{
+		"other key name":   {key: renamed, sig: sig},
+		"no name":          {key: key.Public(), sig: sig[len("build-1:"):]},
+		"not base64":       {key: key.Public(), sig: "build-1:!!!"},
+		"short signature":  {key: key.Public(), sig: "build-1:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		"empty":            {key: key.Public(), sig: ""},
+		"other key's sigs": {key: rfc8032Key(t, "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60").Public(), sig: sig},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.False(t, tt.key.Verify(msg, tt.sig))
+		})
+	}
+	assert.True(t, key.Public().Verify(msg, sig))
+	assert.Equal(t, "build-1", SignerName(sig))
+}
+
+func TestParseKeys(t *testing.T) {
+	key, err := GenerateKey("cache.example.com-1")
+	require.NoError(t, err)
+	back, err := ParseSecretKey(key.String() + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, key, back)
+
+	tests := []struct {
+		in      string
+		wantErr string
+	}{
+		{in: "", wantErr: "must look like name:base64"},
+		{in: "nocolon", wantErr: "must look like name:base64"},
+		{in: ":" + key.Public().String()[len("cache.example.com-1:"):], wantErr: "must look like name:base64"},
+		{in: "a b:AAAA", wantErr: "must look like name:base64"},
+		{in: "k:AAAA", wantErr: "not a 32-byte base64 ed25519 key"},
+		{in: "k:not base64", wantErr: "not a 32-byte base64 ed25519 key"},
+		{in: key.String(), wantErr: "not a 32-byte base64 ed25519 key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := ParsePublicKey(tt.in)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+	_, err = ParseSecretKey(key.Public().String())
+	assert.ErrorContains(t, err, "not a 64-byte base64 ed25519 key")
+
+	_, err = GenerateKey("bad:name")
+	assert.ErrorContains(t, err, "without spaces or ':'")
+}
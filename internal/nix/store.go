@@ -0,0 +1,272 @@
+package nix
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PathInfo is a store path's registration in the nix database — everything
+// nix-store --import needs besides the NAR itself.
+type PathInfo struct {
+	Path       string   `json:"path"`
+	NarHash    string   `json:"nar_hash"` // "sha256:<nix32>" of the path's NAR serialisation
+	NarSize    int64    `json:"nar_size"`
+	References []string `json:"references,omitempty"`
+	Deriver    string   `json:"deriver,omitempty"`
+}
+
+// QueryPathInfo reads the registration of every path from the local store and
+// returns them dependencies first, the order nix-store --import needs.
+func QueryPathInfo(paths []string) ([]PathInfo, error) {
+	out, err := exec.Command("nix-store", append([]string{"--dump-db"}, paths...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("nix-store --dump-db: %w", err)
+	}
+	infos, err := parseDumpDB(out)
+	if err != nil {
+		return nil, err
+	}
+	return sortByReferences(infos), nil
+}
+
+// parseDumpDB parses nix's validity registration format: per path, its name,
+// hash, size, deriver (maybe empty), a reference count and that many references.
+func parseDumpDB(b []byte) ([]PathInfo, error) {
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	next := func() (string, bool) {
+		if !s.Scan() {
+			return "", false
+		}
+		return s.Text(), true
+	}
+	var infos []PathInfo
+	for {
+		path, more := next()
+		if !more || path == "" {
+			break
+		}
+		hash, _ := next()
+		size, _ := next()
+		deriver, _ := next()
+		count, more := next()
+		if !more {
+			return nil, fmt.Errorf("nix-store --dump-db: truncated entry for %s", path)
+		}
+		digest, err := ParseSHA256(hash)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		info := PathInfo{Path: path, NarHash: FormatSHA256(digest), Deriver: deriver}
+		if info.NarSize, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return nil, fmt.Errorf("%s: bad nar size %q", path, size)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad reference count %q", path, count)
+		}
+		for range n {
+			ref, _ := next()
+			info.References = append(info.References, ref)
+		}
+		slices.Sort(info.References)
+		infos = append(infos, info)
+	}
+	return infos, s.Err()
+}
+
+// sortByReferences orders infos so every path comes after the paths it references.
+func sortByReferences(infos []PathInfo) []PathInfo {
+	byPath := map[string]PathInfo{}
+	for _, i := range infos {
+		byPath[i.Path] = i
+	}
+	// sorted input keeps the output stable from run to run
+	names := make([]string, 0, len(infos))
+	for p := range byPath {
+		names = append(names, p)
+	}
+	slices.Sort(names)
+
+	done := map[string]bool{}
+	sorted := make([]PathInfo, 0, len(infos))
+	var visit func(p string)
+	visit = func(p string) {
+		info, ok := byPath[p]
+		if !ok || done[p] {
+			return
+		}
+		done[p] = true
+		for _, ref := range info.References {
+			visit(ref)
+		}
+		sorted = append(sorted, info)
+	}
+	for _, p := range names {
+		visit(p)
+	}
+	return sorted
+}
+
+// InvalidPaths returns those of paths that aren't valid in the local store.
+func InvalidPaths(paths []string) ([]string, error) {
+	var invalid []string
+	// batches keep the argument list well under ARG_MAX
+	for len(paths) > 0 {
+		n := min(len(paths), 500)
+		cmd := exec.Command("nix-store", append([]string{"--check-validity", "--print-invalid"}, paths[:n]...)...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("nix-store --check-validity: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		invalid = append(invalid, strings.Fields(string(out))...)
+		paths = paths[n:]
+	}
+	return invalid, nil
+}
+
+// DumpPath writes the NAR serialisation of path to w.
+func DumpPath(path string, w io.Writer) error {
+	cmd := exec.Command("nix-store", "--dump", path)
+	var stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = w, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("nix-store --dump %s: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// exportMagic follows each NAR in the nix-store --export format.
+const exportMagic = 0x4558494e
+
+// ExportWriter produces the stream nix-store --export writes and --import reads:
+// per path a 1, the NAR, then its registration; a 0 ends the stream. NAR bytes go
+// straight through Write between StartPath and EndPath.
+type ExportWriter struct {
+	w io.Writer
+}
+
+func (e *ExportWriter) Write(p []byte) (int, error) {
+	return e.w.Write(p)
+}
+
+// StartPath announces the next path's NAR.
+func (e *ExportWriter) StartPath() error {
+	return e.writeInt(1)
+}
+
+// EndPath writes the registration that follows info's NAR.
+func (e *ExportWriter) EndPath(info PathInfo) error {
+	if err := e.writeInt(exportMagic); err != nil {
+		return err
+	}
+	if err := e.writeString(info.Path); err != nil {
+		return err
+	}
+	if err := e.writeInt(uint64(len(info.References))); err != nil {
+		return err
+	}
+	for _, ref := range info.References {
+		if err := e.writeString(ref); err != nil {
+			return err
+		}
+	}
+	if err := e.writeString(info.Deriver); err != nil {
+		return err
+	}
+	return e.writeInt(0) // no signatures
+}
+
+// writeInt writes a little-endian uint64, nix's wire integer.
+func (e *ExportWriter) writeInt(n uint64) error {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	_, err := e.w.Write(b[:])
+	return err
+}
+
+// writeString writes a length-prefixed string, zero-padded to 8 bytes.
+func (e *ExportWriter) writeString(s string) error {
+	if err := e.writeInt(uint64(len(s))); err != nil {
+		return err
+	}
+	pad := (8 - len(s)%8) % 8
+	_, err := e.w.Write(append([]byte(s), make([]byte, pad)...))
+	return err
+}
+
+// Importer feeds an export stream into nix-store --import as it's written.
+type Importer struct {
+	*ExportWriter
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr bytes.Buffer
+	waited bool
+	err    error
+}
+
+// StartImport starts nix-store --import. call Finish after the last path, or Abort.
+func StartImport() (*Importer, error) {
+	im := &Importer{cmd: exec.Command("nix-store", "--import")}
+	im.cmd.Stderr = &im.stderr
+	stdin, err := im.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := im.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("nix-store --import: %w", err)
+	}
+	im.stdin = stdin
+	im.ExportWriter = &ExportWriter{w: importPipe{im}}
+	return im, nil
+}
+
+// importPipe reports why nix stopped reading rather than a bare broken pipe.
+type importPipe struct{ im *Importer }
+
+func (p importPipe) Write(b []byte) (int, error) {
+	n, err := p.im.stdin.Write(b)
+	if err != nil {
+		if werr := p.im.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (im *Importer) wait() error {
+	if !im.waited {
+		im.stdin.Close()
+		if err := im.cmd.Wait(); err != nil {
+			im.err = fmt.Errorf("nix-store --import: %w: %s", err, strings.TrimSpace(im.stderr.String()))
+		}
+		im.waited = true
+	}
+	return im.err
+}
+
+// Finish ends the stream and waits for nix to register the paths.
+func (im *Importer) Finish() error {
+	err := im.writeInt(0)
+	if werr := im.wait(); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// Abort stops the import. a path whose registration wasn't written yet is not added.
+func (im *Importer) Abort() {
+	if !im.waited {
+		im.cmd.Process.Kill()
+	}
+	im.wait()
+}
@@ -0,0 +1,104 @@
+package nix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	glibc    = "/nix/store/aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa-glibc-2.39"
+	bash     = "/nix/store/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb-bash-5.2"
+	hello    = "/nix/store/cccccccccccccccccccccccccccccccc-hello-2.12"
+	helloDrv = "/nix/store/dddddddddddddddddddddddddddddddd-hello-2.12.drv"
+
+	// sha256 of nothing, as --dump-db may print it and as PathInfo stores it
+	emptyHex = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	emptyB32 = "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73"
+	emptyNix = "sha256:" + emptyB32
+)
+
+func TestParseDumpDB(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []PathInfo
+		wantErr string
+	}{
+		{
+			name: "entries with and without refs",
+			in: hello + "\n" + emptyHex + "\n1234\n" + helloDrv + "\n2\n" + hello + "\n" + glibc + "\n" +
+				glibc + "\n" + emptyB32 + "\n99\n\n0\n",
+			want: []PathInfo{
+				{Path: hello, NarHash: emptyNix, NarSize: 1234, Deriver: helloDrv, References: []string{glibc, hello}},
+				{Path: glibc, NarHash: emptyNix, NarSize: 99},
+			},
+		},
+		{
+			name: "stops at a blank line",
+			in:   glibc + "\n" + emptyHex + "\n99\n\n0\n\n",
+			want: []PathInfo{{Path: glibc, NarHash: emptyNix, NarSize: 99}},
+		},
+		{name: "empty", in: "", want: nil},
+		{name: "truncated", in: glibc + "\n" + emptyHex + "\n99\n", wantErr: "truncated entry for " + glibc},
+		{name: "bad hash", in: glibc + "\nsha256:nope\n99\n\n0\n", wantErr: "unrecognised sha256"},
+		{name: "bad size", in: glibc + "\n" + emptyHex + "\nbig\n\n0\n", wantErr: `bad nar size "big"`},
+		{name: "bad count", in: glibc + "\n" + emptyHex + "\n99\n\nsome\n", wantErr: `bad reference count "some"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDumpDB([]byte(tt.in))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSortByReferences(t *testing.T) {
+	info := func(path string, refs ...string) PathInfo {
+		return PathInfo{Path: path, References: refs}
+	}
+	paths := func(infos []PathInfo) []string {
+		var out []string
+		for _, i := range infos {
+			out = append(out, i.Path)
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		in   []PathInfo
+		want []string
+	}{
+		{
+			name: "dependencies first",
+			in:   []PathInfo{info(hello, glibc, bash, hello), info(bash, glibc), info(glibc)},
+			want: []string{glibc, bash, hello},
+		},
+		{
+			name: "refs outside the set are skipped",
+			in:   []PathInfo{info(hello, "/nix/store/zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz-gone")},
+			want: []string{hello},
+		},
+		{
+			name: "independent paths keep sorted order",
+			in:   []PathInfo{info(hello), info(bash), info(glibc)},
+			want: []string{glibc, bash, hello},
+		},
+		{
+			name: "duplicates collapse",
+			in:   []PathInfo{info(glibc), info(glibc)},
+			want: []string{glibc},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, paths(sortByReferences(tt.in)))
+		})
+	}
+}
@@ -3,15 +3,17 @@ package nix
 // shellNixTemplate is the nix expression we write to the cache dir.
 // bash and coreutils are always included — without them the sandbox has no shell or /usr/bin/env.
 // {{COMMIT}} and {{SHA256}} are the pinned nixpkgs values from lagoon.toml.
-// {{PACKAGES}} is the user's package list, one name per line, indented.
+// {{IMPORT_ARGS}} is what nixpkgs is imported with — "{}" unless there are overlays.
+// {{PINS}} is a let block importing each nixpkgs revision single packages are pinned to — empty if none.
+// {{PACKAGES}} is the user's package list plus language environments, one entry per line, indented.
 // dockerNixTemplate builds a layered Docker image from the environment's packages.
 // {{NAME}} is the image name (e.g. "lagoon-myapp"), {{PACKAGES}} are 4-space-indented.
 const dockerNixTemplate = `{ pkgs ? import (fetchTarball {
     url = "https://github.com/NixOS/nixpkgs/archive/{{COMMIT}}.tar.gz";
     sha256 = "{{SHA256}}";
-  }) {} }:
+  }) {{IMPORT_ARGS}} }:
 
-pkgs.dockerTools.buildLayeredImage {
+{{PINS}}pkgs.dockerTools.buildLayeredImage {
   name = "{{NAME}}";
   tag = "latest";
   contents = with pkgs; [
@@ -26,10 +28,10 @@ pkgs.dockerTools.buildLayeredImage {
 const shellNixTemplate = `{ pkgs ? import (fetchTarball {
     url = "https://github.com/NixOS/nixpkgs/archive/{{COMMIT}}.tar.gz";
     sha256 = "{{SHA256}}";
-  }) {}
+  }) {{IMPORT_ARGS}}
 }:
 
-pkgs.mkShell {
+{{PINS}}pkgs.mkShell {
   buildInputs = with pkgs; [
     bash
     coreutils
@@ -37,3 +39,25 @@ pkgs.mkShell {
   ];
 }
 `
+
+// flakeNixTemplate is the flake equivalent of shellNixTemplate, used when lagoon.toml
+// pins nixpkgs with a flake ref. {{NIXPKGS}} is the input — a url or a locked attrset.
+// {{SYSTEM}} is the nix system double, e.g. "x86_64-linux". {{PKGS}} is the nixpkgs
+// package set, re-imported with overlays when there are any. {{PINS}} adds a binding
+// per nixpkgs revision that single packages are pinned to.
+const flakeNixTemplate = `{
+  inputs.nixpkgs = {{NIXPKGS}};
+
+  outputs = { nixpkgs, ... }:
+    let pkgs = {{PKGS}};{{PINS}}
+    in {
+      devShells."{{SYSTEM}}".default = pkgs.mkShell {
+        buildInputs = with pkgs; [
+          bash
+          coreutils
+{{PACKAGES}}
+        ];
+      };
+    };
+}
+`
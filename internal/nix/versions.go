@@ -0,0 +1,33 @@
+package nix
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ParseStoreName splits a store path into package name and version the way nix's
+// builtins.parseDrvName does: the version starts at the first dash not followed by a letter.
+func ParseStoreName(storePath string) (name, version string) {
+	base := filepath.Base(storePath)
+	// drop the 32-char hash and its dash
+	if len(base) > 33 && base[32] == '-' {
+		base = base[33:]
+	}
+	for i := 0; i < len(base)-1; i++ {
+		if base[i] == '-' && !unicode.IsLetter(rune(base[i+1])) {
+			return base[:i], base[i+1:]
+		}
+	}
+	return base, ""
+}
+
+// Versions maps each package on env's PATH to its version.
+func Versions(env *ResolvedEnv) map[string]string {
+	versions := map[string]string{}
+	for _, p := range StorePaths(env) {
+		name, version := ParseStoreName(p)
+		versions[name] = strings.TrimSpace(version)
+	}
+	return versions
+}
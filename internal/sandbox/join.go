@@ -0,0 +1,96 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/imraghavojha/lagoon/internal/nix"
+)
+
+// ReadInfo returns the child pid bwrap wrote to an --info-fd file.
+// the pid is the first process inside the sandbox's namespaces, as seen from the host.
+func ReadInfo(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var info struct {
+		ChildPID int `json:"child-pid"`
+	}
+	if err := json.Unmarshal(b, &info); err != nil || info.ChildPID == 0 {
+		return 0, fmt.Errorf("%s: no child-pid recorded", path)
+	}
+	return info.ChildPID, nil
+}
+
+// IsSandboxed reports whether pid is alive and lives in a different user namespace
+// than us — guards against a recycled pid that now belongs to some host process.
+func IsSandboxed(pid int) bool {
+	theirs, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/user", pid))
+	if err != nil {
+		return false
+	}
+	ours, err := os.Readlink("/proc/self/ns/user")
+	return err == nil && theirs != ours
+}
+
+// Join replaces the current process with a shell inside an already-running sandbox.
+// pid is the sandbox's child pid from ReadInfo. every namespace is shared with it —
+// /tmp, /home, processes and network state are the same the first shell sees.
+// only Cmd and ExtraEnvs in opts apply; mounts and limits were fixed at start.
+func Join(cfg *config.Config, env *nix.ResolvedEnv, pid int, opts Options) error {
+	if err := validateEnvs(opts.ExtraEnvs); err != nil {
+		return err
+	}
+	nsenter, err := exec.LookPath("nsenter")
+	if err != nil {
+		return fmt.Errorf("nsenter not found (part of util-linux): %w", err)
+	}
+
+	argv := []string{
+		"nsenter",
+		"--target", strconv.Itoa(pid),
+		// every namespace that differs from ours: user, mount, pid, net, ipc, uts, cgroup
+		"--all",
+		// keep our uid instead of becoming root in the sandbox's user namespace
+		"--preserve-credentials",
+		// bwrap pivot_roots, so take the sandbox's root and cwd too
+		"--root", "--wd",
+		"--",
+		// nsenter inherits our host env — replace it with the sandbox's
+		env.EnvPath, "-i",
+	}
+	argv = append(argv, sandboxEnv(env, opts.ExtraEnvs)...)
+	argv = append(argv, entryArgv(cfg, env, opts.Cmd)...)
+	return syscall.Exec(nsenter, argv, nil)
+}
+
+// Signal sends sig to every process in the sandbox whose child pid is pid, found
+// by their shared pid namespace. pid itself is the sandbox's init and, as the
+// kernel rules for namespace inits go, only SIGKILL reaches it from outside.
+func Signal(pid int, sig syscall.Signal) error {
+	ns, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/pid", pid))
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		p, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// processes that exit mid-scan just fail the readlink
+		if theirs, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/pid", p)); err == nil && theirs == ns {
+			syscall.Kill(p, sig)
+		}
+	}
+	return nil
+}
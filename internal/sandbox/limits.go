@@ -0,0 +1,187 @@
+package sandbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// systemdProps maps limits onto systemd-run --scope properties.
+func systemdProps(l config.Limits) []string {
+	var args []string
+	if l.Memory != "" {
+		n, _ := l.MemoryBytes() // checked by limitWrap
+		args = append(args, "-p", "MemoryMax="+strconv.FormatInt(n, 10))
+	}
+	if l.CPUs != 0 {
+		args = append(args, "-p", fmt.Sprintf("CPUQuota=%d%%", int(math.Round(l.CPUs*100))))
+	}
+	if l.PidsMax != 0 {
+		args = append(args, "-p", "TasksMax="+strconv.Itoa(l.PidsMax))
+	}
+	if l.IOWeight != 0 {
+		args = append(args, "-p", "IOWeight="+strconv.Itoa(l.IOWeight))
+	}
+	return args
+}
+
+// limitWrap decides how to apply l to bwrap. with systemd-run, bwrap runs in a
+// transient scope and argv0/prefix say how to start it. without, a fresh cgroup v2
+// group is returned instead and the caller puts bwrap into it.
+func limitWrap(l config.Limits, bwrap string) (argv0 string, prefix []string, cgroup string, err error) {
+	if !l.Set() {
+		return bwrap, nil, "", nil
+	}
+	if err := l.Check(); err != nil {
+		return "", nil, "", err
+	}
+	if sysRun, err := exec.LookPath("systemd-run"); err == nil {
+		return sysRun, append(append([]string{"--scope"}, systemdProps(l)...), "--", bwrap), "", nil
+	}
+	cgroup, err = newCgroup(l)
+	if err != nil {
+		return "", nil, "", fmt.Errorf("resource limits need systemd-run or a writable cgroup v2 tree: %w", err)
+	}
+	return bwrap, nil, cgroup, nil
+}
+
+// newCgroup creates a cgroup next to our own with l written to its control files.
+// only works where our cgroup is delegated to us, which is what systemd-run is
+// for — this is the fallback for machines without it.
+func newCgroup(l config.Limits) (string, error) {
+	parent, err := ownCgroup()
+	if err != nil {
+		return "", err
+	}
+	// a previous call already moved us into our leaf; its parent is the one we manage
+	if strings.HasPrefix(filepath.Base(parent), selfPrefix) {
+		parent = filepath.Dir(parent)
+	}
+	sweepCgroups(parent)
+
+	files, controllers := cgroupFiles(l)
+	if err := enableControllers(parent, controllers); err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp(parent, "lagoon-")
+	if err != nil {
+		return "", err
+	}
+	for name, val := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(val), 0); err != nil {
+			os.Remove(dir)
+			return "", fmt.Errorf("setting %s in %s: %w", name, dir, err)
+		}
+	}
+	return dir, nil
+}
+
+// cgroupFiles maps limits onto cgroup v2 control files, and the controllers they need.
+func cgroupFiles(l config.Limits) (map[string]string, []string) {
+	files := map[string]string{}
+	var controllers []string
+	if l.Memory != "" {
+		n, _ := l.MemoryBytes() // checked by limitWrap
+		files["memory.max"] = strconv.FormatInt(n, 10)
+		controllers = append(controllers, "memory")
+	}
+	if l.CPUs != 0 {
+		files["cpu.max"] = fmt.Sprintf("%d 100000", int(math.Round(l.CPUs*100000)))
+		controllers = append(controllers, "cpu")
+	}
+	if l.PidsMax != 0 {
+		files["pids.max"] = strconv.Itoa(l.PidsMax)
+		controllers = append(controllers, "pids")
+	}
+	if l.IOWeight != 0 {
+		files["io.weight"] = "default " + strconv.Itoa(l.IOWeight)
+		controllers = append(controllers, "io")
+	}
+	return files, controllers
+}
+
+// selfPrefix names the leaf cgroup lagoon moves itself into.
+const selfPrefix = "lagoon-self-"
+
+// enableControllers makes controllers available to parent's children. cgroup v2
+// refuses that while parent has processes of its own (EBUSY), so lagoon first
+// moves itself into a leaf beside the sandboxes' groups.
+func enableControllers(parent string, controllers []string) error {
+	control := filepath.Join(parent, "cgroup.subtree_control")
+	enabled, err := os.ReadFile(control)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, c := range controllers {
+		if !slices.Contains(strings.Fields(string(enabled)), c) {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	leaf := filepath.Join(parent, selfPrefix+strconv.Itoa(os.Getpid()))
+	if err := os.Mkdir(leaf, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	// "0" moves the writing process, all threads included
+	if err := os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte("0"), 0); err != nil {
+		os.Remove(leaf)
+		return fmt.Errorf("moving into %s: %w", leaf, err)
+	}
+	for _, c := range missing {
+		err := os.WriteFile(control, []byte("+"+c), 0)
+		if errors.Is(err, syscall.EBUSY) {
+			return fmt.Errorf("enabling the %s controller in %s: other processes share lagoon's cgroup — run lagoon from its own cgroup or install systemd-run", c, parent)
+		}
+		if err != nil {
+			return fmt.Errorf("enabling the %s controller in %s: %w", c, parent, err)
+		}
+	}
+	return nil
+}
+
+// ownCgroup returns the cgroup v2 directory this process belongs to.
+func ownCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// the unified hierarchy is the "0::/path" line
+		if rel, ok := strings.CutPrefix(s.Text(), "0::"); ok {
+			dir := filepath.Join(cgroupRoot, rel)
+			if _, err := os.Stat(filepath.Join(dir, "cgroup.procs")); err != nil {
+				return "", fmt.Errorf("cgroup v2 not mounted at %s", cgroupRoot)
+			}
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 hierarchy")
+}
+
+// sweepCgroups removes groups left by sandboxes that have exited.
+// rmdir only succeeds on empty cgroups, so live sandboxes are untouched.
+func sweepCgroups(parent string) {
+	old, _ := filepath.Glob(filepath.Join(parent, "lagoon-*"))
+	for _, dir := range old {
+		os.Remove(dir)
+	}
+}
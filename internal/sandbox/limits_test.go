@@ -0,0 +1,77 @@
+package sandbox
+
+import (
+	"testing"
+
+	"github.com/imraghavojha/lagoon/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemdProps(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits config.Limits
+		want   []string
+	}{
+		{name: "none", limits: config.Limits{}, want: nil},
+		{
+			name:   "all",
+			limits: config.Limits{Memory: "512m", CPUs: 2, PidsMax: 256, IOWeight: 50},
+			want:   []string{"-p", "MemoryMax=536870912", "-p", "CPUQuota=200%", "-p", "TasksMax=256", "-p", "IOWeight=50"},
+		},
+		{name: "memory as written", limits: config.Limits{Memory: " 1G "}, want: []string{"-p", "MemoryMax=1073741824"}},
+		{name: "fractional cpus", limits: config.Limits{CPUs: 1.5}, want: []string{"-p", "CPUQuota=150%"}},
+		{name: "cpus round to a percent", limits: config.Limits{CPUs: 0.333}, want: []string{"-p", "CPUQuota=33%"}},
+		{name: "float error", limits: config.Limits{CPUs: 0.29}, want: []string{"-p", "CPUQuota=29%"}},
+		{name: "smallest cpus", limits: config.Limits{CPUs: 0.01}, want: []string{"-p", "CPUQuota=1%"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, systemdProps(tt.limits))
+		})
+	}
+}
+
+func TestCgroupFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		limits      config.Limits
+		files       map[string]string
+		controllers []string
+	}{
+		{name: "none", limits: config.Limits{}, files: map[string]string{}},
+		{
+			name:        "all",
+			limits:      config.Limits{Memory: "2g", CPUs: 1, PidsMax: 64, IOWeight: 200},
+			files:       map[string]string{"memory.max": "2147483648", "cpu.max": "100000 100000", "pids.max": "64", "io.weight": "default 200"},
+			controllers: []string{"memory", "cpu", "pids", "io"},
+		},
+		{
+			name:        "fractional cpus",
+			limits:      config.Limits{CPUs: 1.5},
+			files:       map[string]string{"cpu.max": "150000 100000"},
+			controllers: []string{"cpu"},
+		},
+		{
+			// 0.29*100000 is 28999.999… in floating point
+			name:        "cpus round rather than truncate",
+			limits:      config.Limits{CPUs: 0.29},
+			files:       map[string]string{"cpu.max": "29000 100000"},
+			controllers: []string{"cpu"},
+		},
+		{
+			// the kernel's minimum quota is 1000µs
+			name:        "smallest cpus",
+			limits:      config.Limits{CPUs: 0.01},
+			files:       map[string]string{"cpu.max": "1000 100000"},
+			controllers: []string{"cpu"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, controllers := cgroupFiles(tt.limits)
+			assert.Equal(t, tt.files, files)
+			assert.Equal(t, tt.controllers, controllers)
+		})
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -22,12 +24,29 @@ func validateEnvs(extraEnvs []string) error {
 	return nil
 }
 
+// Bind is a host directory mounted into the sandbox.
+// a Target starting with "~/" is relative to the sandbox home directory.
+type Bind struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// Options are the per-invocation settings that don't come from lagoon.toml.
+type Options struct {
+	Cmd       string        // one-off command; empty opens an interactive shell
+	Limits    config.Limits // resource caps via systemd-run, or a cgroup without it; zero = no limits
+	ExtraEnvs []string      // additional KEY=VALUE pairs injected into the sandbox
+	Dir       string        // working dir inside the sandbox, relative to /workspace; empty = /workspace
+	Binds     []Bind        // extra host directories, mounted after /home and /tmp so they can live inside them
+	Wrap      []string      // argv run inside the sandbox in front of the command (e.g. the network helper)
+	InfoFile  string        // bwrap writes the sandbox's child pid here (--info-fd)
+	Secrets   []Secret      // mounted read-only under /run/secrets
+}
+
 // Enter replaces the current process with a bwrap sandbox.
-// cmd is a one-off command to run; empty string opens an interactive shell.
-// memory limits sandbox via systemd-run (e.g. "512m", "1g"); empty = no limit.
-// extraEnvs are additional KEY=VALUE pairs injected into the sandbox.
-func Enter(cfg *config.Config, env *nix.ResolvedEnv, projectPath, cmd, memory string, extraEnvs []string) error {
-	if err := validateEnvs(extraEnvs); err != nil {
+func Enter(cfg *config.Config, env *nix.ResolvedEnv, projectPath string, opts Options) error {
+	if err := validateEnvs(opts.ExtraEnvs); err != nil {
 		return err
 	}
 	bwrap, err := exec.LookPath("bwrap")
@@ -35,52 +54,167 @@ func Enter(cfg *config.Config, env *nix.ResolvedEnv, projectPath, cmd, memory st
 		return fmt.Errorf("bwrap not found: %w", err)
 	}
 
-	bwrapArgs := buildArgs(cfg, env, projectPath, cmd, extraEnvs)
-
-	if memory != "" {
-		sysRun, err := exec.LookPath("systemd-run")
+	infoFD := -1
+	if opts.InfoFile != "" {
+		// syscall.Open doesn't set O_CLOEXEC, so the fd survives the exec into bwrap
+		infoFD, err = syscall.Open(opts.InfoFile, syscall.O_CREAT|syscall.O_WRONLY|syscall.O_TRUNC, 0644)
 		if err != nil {
-			return fmt.Errorf("--memory requires systemd-run (not found on this system): %w", err)
+			return fmt.Errorf("opening %s: %w", opts.InfoFile, err)
+		}
+	}
+
+	// like the info fd, these have to stay open across the exec
+	secretFDs := make([]int, len(opts.Secrets))
+	for i, sec := range opts.Secrets {
+		if secretFDs[i], err = secretFD(sec, 0); err != nil {
+			return err
+		}
+	}
+
+	bwrapArgs := buildArgs(cfg, env, projectPath, opts, infoFD, secretFDs)
+
+	argv0, prefix, cgroup, err := limitWrap(opts.Limits, bwrap)
+	if err != nil {
+		return err
+	}
+	if cgroup != "" {
+		// "0" moves the writing process — bwrap inherits the cgroup across exec
+		if err := os.WriteFile(filepath.Join(cgroup, "cgroup.procs"), []byte("0"), 0); err != nil {
+			return fmt.Errorf("joining %s: %w", cgroup, err)
 		}
-		// wrap bwrap in a transient systemd scope with the memory limit
-		argv := append([]string{"systemd-run", "--scope", "-p", "MemoryMax=" + strings.ToUpper(memory), "--", bwrap}, bwrapArgs...)
-		return syscall.Exec(sysRun, argv, nil)
 	}
 
 	// sandbox env is set via --clearenv + --setenv inside buildArgs.
 	// bwrap's own process env (third arg) doesn't affect the sandboxed shell.
-	return syscall.Exec(bwrap, append([]string{"bwrap"}, bwrapArgs...), nil)
+	argv := append(append([]string{filepath.Base(argv0)}, prefix...), bwrapArgs...)
+	return syscall.Exec(argv0, argv, nil)
 }
 
 // Build returns a configured-but-unstarted bwrap command.
 // the caller must set Stdout/Stderr then call cmd.Start().
-func Build(cfg *config.Config, env *nix.ResolvedEnv, projectPath, cmd, memory string, extraEnvs []string) (*exec.Cmd, error) {
-	if err := validateEnvs(extraEnvs); err != nil {
+// the info file, secret memfds and cgroup fd stay open for the child — call
+// CloseFiles once Start has returned.
+func Build(cfg *config.Config, env *nix.ResolvedEnv, projectPath string, opts Options) (*exec.Cmd, error) {
+	if err := validateEnvs(opts.ExtraEnvs); err != nil {
 		return nil, err
 	}
 	bwrap, err := exec.LookPath("bwrap")
 	if err != nil {
 		return nil, fmt.Errorf("bwrap not found: %w", err)
 	}
-	bwrapArgs := buildArgs(cfg, env, projectPath, cmd, extraEnvs)
-	if memory != "" {
-		sysRun, err := exec.LookPath("systemd-run")
+
+	name, prefix, cgroup, err := limitWrap(opts.Limits, bwrap)
+	if err != nil {
+		return nil, err
+	}
+
+	var extra []*os.File
+	infoFD := -1
+	if opts.InfoFile != "" {
+		f, err := os.Create(opts.InfoFile)
 		if err != nil {
-			return nil, fmt.Errorf("--memory requires systemd-run: %w", err)
+			return nil, err
 		}
-		return exec.Command(sysRun, append([]string{"--scope", "-p", "MemoryMax=" + strings.ToUpper(memory), "--", bwrap}, bwrapArgs...)...), nil
+		extra = append(extra, f)
+		infoFD = 3 // ExtraFiles start right after stdin/stdout/stderr
 	}
-	return exec.Command(bwrap, bwrapArgs...), nil
+	secrets, err := secretFiles(opts.Secrets)
+	if err != nil {
+		for _, f := range extra {
+			f.Close()
+		}
+		return nil, err
+	}
+	secretFDs := make([]int, len(secrets))
+	for i := range secrets {
+		secretFDs[i] = 3 + len(extra) + i
+	}
+	extra = append(extra, secrets...)
+	var cgroupFD int
+	if cgroup != "" {
+		// the child is cloned straight into the cgroup, so nothing escapes it before exec
+		cgroupFD, err = syscall.Open(cgroup, syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			for _, f := range extra {
+				f.Close()
+			}
+			return nil, fmt.Errorf("opening %s: %w", cgroup, err)
+		}
+	}
+
+	cmd := exec.Command(name, append(prefix, buildArgs(cfg, env, projectPath, opts, infoFD, secretFDs)...)...)
+	cmd.ExtraFiles = extra
+	if cgroup != "" {
+		cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: cgroupFD}
+	}
+	return cmd, nil
 }
 
-// buildArgs constructs the full bwrap argument list.
-// order matters here — bwrap processes flags left to right.
-func buildArgs(cfg *config.Config, env *nix.ResolvedEnv, projectPath, cmd string, extraEnvs []string) []string {
-	// match /etc/passwd — tools like git resolve ~ using the passwd entry, not bare $HOME
-	sandboxHome := "/home"
+// CloseFiles closes the fds Build opened for cmd's child, which has its own
+// copies once Start returns. safe to call more than once.
+func CloseFiles(cmd *exec.Cmd) {
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
+	}
+	if a := cmd.SysProcAttr; a != nil && a.UseCgroupFD {
+		syscall.Close(a.CgroupFD)
+		a.UseCgroupFD = false
+	}
+}
+
+// TargetPath is the cleaned absolute sandbox path a Bind target mounts on.
+func TargetPath(target string) string {
+	if rest, ok := strings.CutPrefix(target, "~/"); ok {
+		return path.Join(sandboxHome(), rest)
+	}
+	return path.Clean(target)
+}
+
+// sandboxHome matches /etc/passwd — tools like git resolve ~ using the passwd entry, not bare $HOME
+func sandboxHome() string {
 	if realHome, err := os.UserHomeDir(); err == nil {
-		sandboxHome = "/home/" + filepath.Base(realHome)
+		return "/home/" + filepath.Base(realHome)
 	}
+	return "/home"
+}
+
+// sandboxEnv returns the full environment inside the sandbox as KEY=VALUE pairs.
+// later entries win, so caller-provided vars can override the defaults.
+func sandboxEnv(env *nix.ResolvedEnv, extraEnvs []string) []string {
+	return append([]string{
+		"HOME=" + sandboxHome(),
+		"PATH=" + env.PATH,
+		"TERM=" + os.Getenv("TERM"),
+		"USER=" + os.Getenv("USER"),
+		"LANG=C.UTF-8",
+		// show [lagoon] prefix in prompt so users know they're in the sandbox
+		"PS1=[lagoon] \\w $ ",
+	}, extraEnvs...)
+}
+
+// entryArgv is the command bwrap runs once the sandbox is set up: an interactive
+// shell or a one-off command, with the on_enter hook injected if set.
+// for interactive: bash -c '<hook>; exec bash' — exec inherits the tty so
+// the user gets a normal interactive shell after the hook runs.
+// for one-off: bash -c '<hook> && <cmd>'
+func entryArgv(cfg *config.Config, env *nix.ResolvedEnv, cmd string) []string {
+	switch {
+	case cmd != "" && cfg.OnEnter != "":
+		return []string{env.BashPath, "-c", cfg.OnEnter + " && " + cmd}
+	case cmd != "":
+		return []string{env.BashPath, "-c", cmd}
+	case cfg.OnEnter != "":
+		return []string{env.BashPath, "-c", cfg.OnEnter + "; exec " + env.BashPath}
+	default:
+		return []string{env.BashPath}
+	}
+}
+
+// buildArgs constructs the full bwrap argument list.
+// order matters here — bwrap processes flags left to right.
+// infoFD is an inherited fd for --info-fd, or -1 for none; secretFDs hold opts.Secrets.
+func buildArgs(cfg *config.Config, env *nix.ResolvedEnv, projectPath string, opts Options, infoFD int, secretFDs []int) []string {
+	home := sandboxHome()
 
 	args := []string{
 		// nix store is read-only — packages live here
@@ -89,11 +223,11 @@ func buildArgs(cfg *config.Config, env *nix.ResolvedEnv, projectPath, cmd string
 		// project directory mounted as /workspace
 		"--bind", projectPath, "/workspace",
 
-		// writable temp and home — ephemeral, gone when shell exits
+		// writable temp and home — ephemeral, gone when shell exits (except opted-in volumes)
 		"--tmpfs", "/tmp",
 		"--tmpfs", "/home",
 		// create the home subdir inside the tmpfs so tools that stat it don't fail
-		"--dir", sandboxHome,
+		"--dir", home,
 
 		// create /etc so we can mount individual files into it
 		"--dir", "/etc",
@@ -124,16 +258,9 @@ func buildArgs(cfg *config.Config, env *nix.ResolvedEnv, projectPath, cmd string
 
 		// wipe inherited env — we'll set exactly what we need via --setenv
 		"--clearenv",
-		"--setenv", "HOME", sandboxHome,
-		"--setenv", "PATH", env.PATH,
-		"--setenv", "TERM", os.Getenv("TERM"),
-		"--setenv", "USER", os.Getenv("USER"),
-		"--setenv", "LANG", "C.UTF-8",
-		// show [lagoon] prefix in prompt so users know they're in the sandbox
-		"--setenv", "PS1", "[lagoon] \\w $ ",
 
-		// start in the project directory
-		"--chdir", "/workspace",
+		// start in the project directory (or a subdir of it)
+		"--chdir", path.Join("/workspace", opts.Dir),
 	}
 
 	// network is off by default — only add --share-net for the "network" profile
@@ -141,28 +268,33 @@ func buildArgs(cfg *config.Config, env *nix.ResolvedEnv, projectPath, cmd string
 		args = append(args, "--share-net")
 	}
 
-	// inject caller-provided env vars (KEY=VALUE)
-	for _, kv := range extraEnvs {
+	// opted-in persistent or host directories; bwrap creates missing mount points
+	for _, b := range opts.Binds {
+		target := TargetPath(b.Target)
+		flag := "--bind"
+		if b.ReadOnly {
+			flag = "--ro-bind"
+		}
+		args = append(args, flag, b.Source, target)
+	}
+
+	// bwrap copies each secret out of its fd into a read-only file
+	args = append(args, secretArgs(opts.Secrets, secretFDs)...)
+
+	// report the sandbox's child pid so 'lagoon exec' can join its namespaces
+	if infoFD >= 0 {
+		args = append(args, "--info-fd", strconv.Itoa(infoFD))
+	}
+
+	// defaults plus caller-provided env vars (KEY=VALUE)
+	for _, kv := range sandboxEnv(env, opts.ExtraEnvs) {
 		parts := strings.SplitN(kv, "=", 2)
 		if len(parts) == 2 {
 			args = append(args, "--setenv", parts[0], parts[1])
 		}
 	}
 
-	// launch interactive shell or one-off command, injecting on_enter hook if set.
-	// for interactive: bash -c '<hook>; exec bash' — exec inherits the tty so
-	// the user gets a normal interactive shell after the hook runs.
-	// for one-off: bash -c '<hook> && <cmd>'
-	switch {
-	case cmd != "" && cfg.OnEnter != "":
-		args = append(args, "--", env.BashPath, "-c", cfg.OnEnter+" && "+cmd)
-	case cmd != "":
-		args = append(args, "--", env.BashPath, "-c", cmd)
-	case cfg.OnEnter != "":
-		args = append(args, "--", env.BashPath, "-c", cfg.OnEnter+"; exec "+env.BashPath)
-	default:
-		args = append(args, "--", env.BashPath)
-	}
-
-	return args
+	args = append(args, "--")
+	args = append(args, opts.Wrap...)
+	return append(args, entryArgv(cfg, env, opts.Cmd)...)
 }
@@ -0,0 +1,22 @@
+package sandbox
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetPath(t *testing.T) {
+	t.Setenv("HOME", "/Users/sam")
+	tests := map[string]string{
+		"/data":         "/data",
+		"/data/":        "/data",
+		"/tmp/../data":  "/data",
+		"~/":            "/home/sam",
+		"~/.cache":      "/home/sam/.cache",
+		"~/a/../.cache": "/home/sam/.cache",
+	}
+	for target, want := range tests {
+		assert.Equal(t, want, TargetPath(target), target)
+	}
+}
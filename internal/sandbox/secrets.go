@@ -0,0 +1,67 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// SecretsDir is where secrets appear inside the sandbox, one read-only file each.
+const SecretsDir = "/run/secrets"
+
+// Secret is a value mounted at SecretsDir/<Name>. it reaches bwrap through a memfd,
+// so it's never written to disk and never shows up in argv or the environment.
+type Secret struct {
+	Name string
+	Data []byte
+}
+
+// secretFD puts s in an anonymous memory file, rewound so bwrap reads all of it.
+// flags is 0 when the fd has to survive an exec, MFD_CLOEXEC otherwise.
+func secretFD(s Secret, flags int) (int, error) {
+	fd, err := unix.MemfdCreate("lagoon-secret-"+s.Name, flags)
+	if err != nil {
+		return -1, fmt.Errorf("secret %q: memfd_create: %w", s.Name, err)
+	}
+	for b := s.Data; len(b) > 0; {
+		n, err := unix.Write(fd, b)
+		if err != nil {
+			unix.Close(fd)
+			return -1, fmt.Errorf("secret %q: %w", s.Name, err)
+		}
+		b = b[n:]
+	}
+	if _, err := unix.Seek(fd, 0, 0); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("secret %q: %w", s.Name, err)
+	}
+	return fd, nil
+}
+
+// secretFiles opens a memfd per secret for exec.Cmd.ExtraFiles.
+func secretFiles(secrets []Secret) ([]*os.File, error) {
+	var files []*os.File
+	for _, s := range secrets {
+		fd, err := secretFD(s, unix.MFD_CLOEXEC)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, os.NewFile(uintptr(fd), s.Name))
+	}
+	return files, nil
+}
+
+// secretArgs mounts each secret from the fd at the same index.
+func secretArgs(secrets []Secret, fds []int) []string {
+	var args []string
+	for i, s := range secrets {
+		args = append(args, "--ro-bind-data", strconv.Itoa(fds[i]), path.Join(SecretsDir, s.Name))
+	}
+	return args
+}